@@ -0,0 +1,140 @@
+/*
+Copyright 2020 noris network AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingestion
+
+import (
+	"errors"
+	"fmt"
+)
+
+// AutoScalerConfig scales the taskCount of the supervisor with the consumer
+// lag. Unset optional fields are left to Druid's defaults.
+type AutoScalerConfig struct {
+	EnableTaskAutoScaler                 bool     `json:"enableTaskAutoScaler"`
+	AutoScalerStrategy                   string   `json:"autoScalerStrategy"`
+	TaskCountMax                         int      `json:"taskCountMax"`
+	TaskCountMin                         int      `json:"taskCountMin"`
+	TaskCountStart                       *int     `json:"taskCountStart,omitempty"`
+	MinTriggerScaleActionFrequencyMillis *int64   `json:"minTriggerScaleActionFrequencyMillis,omitempty"`
+	LagCollectionIntervalMillis          *int64   `json:"lagCollectionIntervalMillis,omitempty"`
+	LagCollectionRangeMillis             *int64   `json:"lagCollectionRangeMillis,omitempty"`
+	ScaleOutThreshold                    *int64   `json:"scaleOutThreshold,omitempty"`
+	TriggerScaleOutFractionThreshold     *float64 `json:"triggerScaleOutFractionThreshold,omitempty"`
+	ScaleInThreshold                     *int64   `json:"scaleInThreshold,omitempty"`
+	TriggerScaleInFractionThreshold      *float64 `json:"triggerScaleInFractionThreshold,omitempty"`
+	ScaleActionStartDelayMillis          *int64   `json:"scaleActionStartDelayMillis,omitempty"`
+	ScaleActionPeriodMillis              *int64   `json:"scaleActionPeriodMillis,omitempty"`
+	ScaleInStep                          *int     `json:"scaleInStep,omitempty"`
+	ScaleOutStep                         *int     `json:"scaleOutStep,omitempty"`
+}
+
+// Druid's defaults for the lag thresholds, used to check thresholds that are
+// only set on one side.
+const (
+	defaultScaleOutThreshold = 6000000
+	defaultScaleInThreshold  = 1000000
+)
+
+// Validate checks that the task counts, thresholds and scale actions of the
+// autoscaler are consistent.
+func (c AutoScalerConfig) Validate() error {
+	if c.AutoScalerStrategy != "lagBased" {
+		return fmt.Errorf("unknown autoScalerStrategy %q, expected 'lagBased'", c.AutoScalerStrategy)
+	}
+	if c.TaskCountMin < 1 {
+		return errors.New("taskCountMin must be at least 1")
+	}
+	if c.TaskCountMax < c.TaskCountMin {
+		return errors.New("taskCountMax must not be less than taskCountMin")
+	}
+	if c.TaskCountStart != nil && (*c.TaskCountStart < c.TaskCountMin || *c.TaskCountStart > c.TaskCountMax) {
+		return errors.New("taskCountStart must be between taskCountMin and taskCountMax")
+	}
+
+	scaleOut, scaleIn := int64(defaultScaleOutThreshold), int64(defaultScaleInThreshold)
+	if c.ScaleOutThreshold != nil {
+		scaleOut = *c.ScaleOutThreshold
+	}
+	if c.ScaleInThreshold != nil {
+		scaleIn = *c.ScaleInThreshold
+	}
+	if scaleIn < 0 {
+		return errors.New("scaleInThreshold must not be negative")
+	}
+	if scaleIn >= scaleOut {
+		return fmt.Errorf("scaleInThreshold (%d) must be less than scaleOutThreshold (%d)", scaleIn, scaleOut)
+	}
+
+	fractions := []struct {
+		name  string
+		value *float64
+	}{
+		{"triggerScaleOutFractionThreshold", c.TriggerScaleOutFractionThreshold},
+		{"triggerScaleInFractionThreshold", c.TriggerScaleInFractionThreshold},
+	}
+	for _, f := range fractions {
+		if f.value != nil && (*f.value <= 0 || *f.value > 1) {
+			return fmt.Errorf("%s must be greater than 0 and at most 1", f.name)
+		}
+	}
+
+	steps := []struct {
+		name  string
+		value *int
+	}{
+		{"scaleInStep", c.ScaleInStep},
+		{"scaleOutStep", c.ScaleOutStep},
+	}
+	for _, s := range steps {
+		if s.value != nil && *s.value < 1 {
+			return fmt.Errorf("%s must be at least 1", s.name)
+		}
+	}
+
+	millis := []struct {
+		name  string
+		value *int64
+	}{
+		{"minTriggerScaleActionFrequencyMillis", c.MinTriggerScaleActionFrequencyMillis},
+		{"lagCollectionIntervalMillis", c.LagCollectionIntervalMillis},
+		{"lagCollectionRangeMillis", c.LagCollectionRangeMillis},
+		{"scaleActionStartDelayMillis", c.ScaleActionStartDelayMillis},
+		{"scaleActionPeriodMillis", c.ScaleActionPeriodMillis},
+	}
+	for _, m := range millis {
+		if m.value != nil && *m.value <= 0 {
+			return fmt.Errorf("%s must be positive", m.name)
+		}
+	}
+	if c.LagCollectionIntervalMillis != nil && c.LagCollectionRangeMillis != nil &&
+		*c.LagCollectionRangeMillis < *c.LagCollectionIntervalMillis {
+		return errors.New("lagCollectionRangeMillis must not be less than lagCollectionIntervalMillis")
+	}
+	return nil
+}
+
+// SetAutoScalerConfig enables the task autoscaler of the supervisor. If no
+// strategy is set, 'lagBased' is used.
+func SetAutoScalerConfig(cfg AutoScalerConfig) KafkaIngestionSpecOptions {
+	return func(spec *KafkaIngestionSpec) {
+		cfg.EnableTaskAutoScaler = true
+		if cfg.AutoScalerStrategy == "" {
+			cfg.AutoScalerStrategy = "lagBased"
+		}
+		spec.IOConfig.AutoScalerConfig = &cfg
+	}
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2020 noris network AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingestion
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func int64Pointer(i int64) *int64 {
+	return &i
+}
+
+func float64Pointer(f float64) *float64 {
+	return &f
+}
+
+func TestSetAutoScalerConfig(t *testing.T) {
+	spec := NewKafkaIngestionSpec(SetAutoScalerConfig(AutoScalerConfig{
+		TaskCountMin:      1,
+		TaskCountMax:      6,
+		ScaleOutThreshold: int64Pointer(100000),
+		ScaleInThreshold:  int64Pointer(1000),
+		ScaleOutStep:      intPointer(2),
+	}))
+	assert.NoError(t, spec.Validate())
+	actual, err := json.MarshalIndent(spec.IOConfig.AutoScalerConfig, "", "    ")
+	assert.NoError(t, err)
+	assert.Equal(t, `{
+    "enableTaskAutoScaler": true,
+    "autoScalerStrategy": "lagBased",
+    "taskCountMax": 6,
+    "taskCountMin": 1,
+    "scaleOutThreshold": 100000,
+    "scaleInThreshold": 1000,
+    "scaleOutStep": 2
+}`, string(actual))
+}
+
+func TestAutoScalerConfig_Validate(t *testing.T) {
+	valid := func(modify func(*AutoScalerConfig)) AutoScalerConfig {
+		c := AutoScalerConfig{
+			EnableTaskAutoScaler: true,
+			AutoScalerStrategy:   "lagBased",
+			TaskCountMin:         1,
+			TaskCountMax:         4,
+		}
+		modify(&c)
+		return c
+	}
+	var testData = []struct {
+		name   string
+		config AutoScalerConfig
+		err    bool
+	}{
+		{name: "valid", config: valid(func(c *AutoScalerConfig) {})},
+		{name: "unknown strategy", config: valid(func(c *AutoScalerConfig) { c.AutoScalerStrategy = "foo" }), err: true},
+		{name: "no min", config: valid(func(c *AutoScalerConfig) { c.TaskCountMin = 0 }), err: true},
+		{name: "max below min", config: valid(func(c *AutoScalerConfig) { c.TaskCountMax = 0 }), err: true},
+		{name: "start out of range", config: valid(func(c *AutoScalerConfig) { c.TaskCountStart = intPointer(5) }), err: true},
+		{
+			name: "scale in above scale out",
+			config: valid(func(c *AutoScalerConfig) {
+				c.ScaleOutThreshold = int64Pointer(1000)
+				c.ScaleInThreshold = int64Pointer(2000)
+			}),
+			err: true,
+		},
+		{name: "scale out below default scale in", config: valid(func(c *AutoScalerConfig) { c.ScaleOutThreshold = int64Pointer(1000) }), err: true},
+		{name: "fraction above 1", config: valid(func(c *AutoScalerConfig) { c.TriggerScaleOutFractionThreshold = float64Pointer(1.5) }), err: true},
+		{name: "zero step", config: valid(func(c *AutoScalerConfig) { c.ScaleInStep = intPointer(0) }), err: true},
+		{
+			name: "range below interval",
+			config: valid(func(c *AutoScalerConfig) {
+				c.LagCollectionIntervalMillis = int64Pointer(30000)
+				c.LagCollectionRangeMillis = int64Pointer(10000)
+			}),
+			err: true,
+		},
+	}
+
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.config.Validate()
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2020 noris network AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingestion
+
+import (
+	"sort"
+
+	"github.com/prometheus/common/model"
+)
+
+// LabelCardinality describes how a single label is distributed over the
+// analyzed series.
+type LabelCardinality struct {
+	Name string
+	// Values is the number of distinct values of the label.
+	Values int
+	// Series is the number of series that have the label.
+	Series int
+	// Coverage is the ratio of series that have the label, between 0 and 1.
+	Coverage float64
+}
+
+// CardinalityReport holds the cardinality of every label found in a set of
+// series. Labels are sorted by descending number of values, then by name.
+type CardinalityReport struct {
+	Series int
+	Labels []LabelCardinality
+}
+
+// cardinalityCounter collects the distinct values of every label.
+type cardinalityCounter struct {
+	series int
+	values map[string]map[string]bool
+	counts map[string]int
+}
+
+func newCardinalityCounter() *cardinalityCounter {
+	return &cardinalityCounter{
+		values: make(map[string]map[string]bool),
+		counts: make(map[string]int),
+	}
+}
+
+func (c *cardinalityCounter) add(labels map[model.LabelName]model.LabelValue) {
+	c.series++
+	for k, v := range labels {
+		// __name__ is thrown out
+		if k == model.MetricNameLabel {
+			continue
+		}
+		name := string(k)
+		if _, ok := c.values[name]; !ok {
+			c.values[name] = make(map[string]bool)
+		}
+		c.values[name][string(v)] = true
+		c.counts[name]++
+	}
+}
+
+func (c *cardinalityCounter) report() *CardinalityReport {
+	r := &CardinalityReport{
+		Series: c.series,
+		Labels: make([]LabelCardinality, 0, len(c.values)),
+	}
+	for name, values := range c.values {
+		r.Labels = append(r.Labels, LabelCardinality{
+			Name:     name,
+			Values:   len(values),
+			Series:   c.counts[name],
+			Coverage: float64(c.counts[name]) / float64(c.series),
+		})
+	}
+	sort.Slice(r.Labels, func(i, j int) bool {
+		if r.Labels[i].Values != r.Labels[j].Values {
+			return r.Labels[i].Values > r.Labels[j].Values
+		}
+		return r.Labels[i].Name < r.Labels[j].Name
+	})
+	return r
+}
+
+// AnalyzeCardinality computes the cardinality of the labels in a Prometheus
+// query result. Like ExtractUniqueLabels it supports Vector and Matrix
+// results.
+func AnalyzeCardinality(result model.Value) (*CardinalityReport, error) {
+	c := newCardinalityCounter()
+	switch v := result.(type) {
+	case model.Vector:
+		for _, m := range v {
+			c.add(m.Metric)
+		}
+	case model.Matrix:
+		for _, s := range v {
+			c.add(s.Metric)
+		}
+	case nil:
+		return nil, &UnsupportedResultError{Type: model.ValNone}
+	default:
+		return nil, &UnsupportedResultError{Type: v.Type()}
+	}
+	return c.report(), nil
+}
+
+// AnalyzeSeriesCardinality computes the cardinality of the labels in the
+// result of the Prometheus series API.
+func AnalyzeSeriesCardinality(series []model.LabelSet) *CardinalityReport {
+	c := newCardinalityCounter()
+	for _, s := range series {
+		c.add(s)
+	}
+	return c.report()
+}
+
+// Select returns the labels of the report that have at most maxValues
+// distinct values and are present on at least minCoverage of the series.
+// A maxValues of 0 and a minCoverage of 0 disable the respective check.
+func (r *CardinalityReport) Select(maxValues int, minCoverage float64) LabelSet {
+	labels := LabelSet{}
+	for _, l := range r.Labels {
+		if maxValues > 0 && l.Values > maxValues {
+			continue
+		}
+		if l.Coverage < minCoverage {
+			continue
+		}
+		labels = append(labels, l.Name)
+	}
+	return labels
+}
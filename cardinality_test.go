@@ -0,0 +1,104 @@
+/*
+Copyright 2020 noris network AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingestion
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+var cardinalitySeries = []model.LabelSet{
+	{"__name__": "up", "job": "node", "instance": "a"},
+	{"__name__": "up", "job": "node", "instance": "b"},
+	{"__name__": "up", "job": "node", "instance": "c"},
+	{"__name__": "up", "job": "api", "instance": "d", "pod": "api-1"},
+}
+
+var expectedCardinalityReport = &CardinalityReport{
+	Series: 4,
+	Labels: []LabelCardinality{
+		{Name: "instance", Values: 4, Series: 4, Coverage: 1},
+		{Name: "job", Values: 2, Series: 4, Coverage: 1},
+		{Name: "pod", Values: 1, Series: 1, Coverage: 0.25},
+	},
+}
+
+func TestAnalyzeCardinality(t *testing.T) {
+	vector := model.Vector{}
+	matrix := model.Matrix{}
+	for _, s := range cardinalitySeries {
+		vector = append(vector, newSample(model.Metric(s), 0, unixTimestamp))
+		matrix = append(matrix, newSampleStream(model.Metric(s), unixTimestamp))
+	}
+
+	for _, in := range []model.Value{vector, matrix} {
+		r, err := AnalyzeCardinality(in)
+		assert.NoError(t, err)
+		assert.Equal(t, expectedCardinalityReport, r)
+	}
+
+	r, err := AnalyzeCardinality(model.Vector{})
+	assert.NoError(t, err)
+	assert.Equal(t, &CardinalityReport{Labels: []LabelCardinality{}}, r)
+
+	_, err = AnalyzeCardinality(&model.Scalar{})
+	var unsupported *UnsupportedResultError
+	assert.True(t, errors.As(err, &unsupported))
+}
+
+func TestAnalyzeSeriesCardinality(t *testing.T) {
+	assert.Equal(t, expectedCardinalityReport, AnalyzeSeriesCardinality(cardinalitySeries))
+}
+
+func TestCardinalityReport_Select(t *testing.T) {
+	var testData = []struct {
+		name        string
+		maxValues   int
+		minCoverage float64
+		expected    LabelSet
+	}{
+		{
+			name:     "no limits",
+			expected: LabelSet{"instance", "job", "pod"},
+		},
+		{
+			name:      "max values",
+			maxValues: 2,
+			expected:  LabelSet{"job", "pod"},
+		},
+		{
+			name:        "min coverage",
+			minCoverage: 0.5,
+			expected:    LabelSet{"instance", "job"},
+		},
+		{
+			name:        "both",
+			maxValues:   3,
+			minCoverage: 0.5,
+			expected:    LabelSet{"job"},
+		},
+	}
+
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, expectedCardinalityReport.Select(test.maxValues, test.minCoverage))
+		})
+	}
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2020 noris network AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var cardinalityCmd = &cobra.Command{
+	Use:   "cardinality",
+	Short: "Print the number of distinct values and the series coverage of every label",
+	Long: `Print the number of distinct values and the series coverage of every label
+returned by the Prometheus query.
+
+The last column shows whether the label would be used as a dimension with the
+given cardinality limits and label filters. Only the 'query' and 'series'
+discovery are supported.`,
+	Run: cardinality,
+}
+
+func init() {
+	rootCmd.AddCommand(cardinalityCmd)
+}
+
+func cardinality(cmd *cobra.Command, args []string) {
+	if err := checkFlags(cmd); err != nil {
+		fmt.Printf("Error analyzing cardinality: %v\n", err)
+		os.Exit(1)
+	}
+	v1api, err := prometheusAPI()
+	if err != nil {
+		fmt.Printf("Error analyzing cardinality: %v\n", err)
+		os.Exit(1)
+	}
+	filter, err := labelFilter()
+	if err != nil {
+		fmt.Printf("Error analyzing cardinality: %v\n", err)
+		os.Exit(1)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	report, err := analyzeCardinality(ctx, v1api)
+	if err != nil {
+		fmt.Printf("Error analyzing cardinality: %v\n", err)
+		os.Exit(1)
+	}
+
+	selected := map[string]bool{}
+	for _, l := range filter.Apply(report.Select(maxCardinality, minCoverage)) {
+		selected[l] = true
+	}
+
+	fmt.Printf("Series: %d\n\n", report.Series)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "LABEL\tVALUES\tSERIES\tCOVERAGE\tDIMENSION")
+	for _, l := range report.Labels {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%.1f%%\t%t\n", l.Name, l.Values, l.Series, l.Coverage*100, selected[l.Name])
+	}
+	w.Flush()
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2020 noris network AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	ingestion "github.com/noris-network/prometheus-druid-ingestion"
+	"github.com/spf13/cobra"
+)
+
+// exitDiff is the exit code used if the generated spec differs from the
+// running supervisor.
+const exitDiff = 2
+
+var (
+	supervisorID = ""
+	diffCmd      = &cobra.Command{
+		Use:   "diff",
+		Short: "Compare the generated ingestion spec with the running supervisor",
+		Long: `Compare the generated ingestion spec with the spec of the running supervisor.
+
+Exits with 0 if there are no differences, 2 if there are differences and 1 on
+errors.`,
+		Run: diff,
+	}
+)
+
+func init() {
+	addOverlordFlags(diffCmd)
+	diffCmd.Flags().StringVar(&supervisorID, "supervisor-id", supervisorID, "The id of the supervisor to compare against (defaults to the druid data source)")
+	rootCmd.AddCommand(diffCmd)
+}
+
+func diff(cmd *cobra.Command, args []string) {
+	spec, err := buildSpec(cmd)
+	if err != nil {
+		fmt.Printf("Error building ingestion spec: %v\n", err)
+		os.Exit(1)
+	}
+	client, err := overlordClient()
+	if err != nil {
+		fmt.Printf("Error creating Overlord client: %v\n", err)
+		os.Exit(1)
+	}
+
+	id := supervisorID
+	if id == "" {
+		id = druidDataSource
+	}
+	current, err := client.GetSupervisor(context.Background(), id)
+	var overlordErr *ingestion.OverlordError
+	if errors.As(err, &overlordErr) && overlordErr.StatusCode == http.StatusNotFound {
+		fmt.Printf("Supervisor %q does not exist\n", id)
+		os.Exit(exitDiff)
+	}
+	if err != nil {
+		fmt.Printf("Error fetching supervisor: %v\n", err)
+		os.Exit(1)
+	}
+
+	d, err := ingestion.DiffSpecs(current, spec)
+	if err != nil {
+		fmt.Printf("Error comparing ingestion specs: %v\n", err)
+		os.Exit(1)
+	}
+	if d.Empty() {
+		fmt.Printf("Supervisor %q is up to date\n", id)
+		return
+	}
+	fmt.Print(d.String())
+	os.Exit(exitDiff)
+}
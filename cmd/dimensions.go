@@ -0,0 +1,100 @@
+/*
+Copyright 2020 noris network AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	ingestion "github.com/noris-network/prometheus-druid-ingestion"
+)
+
+var (
+	dimensionTypes      = map[string]string{}
+	noBitmapIndex       = []string{}
+	multiValueHandlings = map[string]string{}
+	labelsColumn        = ""
+	promoteLabels       = []string{}
+	schemaMode          = string(ingestion.SchemaModeExplicit)
+	dimensionExclusions = []string{}
+)
+
+func init() {
+	f := rootCmd.PersistentFlags()
+	f.StringToStringVar(&dimensionTypes, "dimension-type", dimensionTypes, "Set the type of label dimensions, e.g. 'le=double,shard=long' (string, long, float or double)")
+	f.StringSliceVar(&noBitmapIndex, "no-bitmap-index", noBitmapIndex, "Store these label dimensions without bitmap index, e.g. for labels with a high cardinality")
+	f.StringVar(&labelsColumn, "labels-column", labelsColumn, "Ingest all labels into this nested json column instead of discovering them (needs Druid 24 or newer)")
+	f.StringSliceVar(&promoteLabels, "promote-labels", promoteLabels, "Store these labels as dimensions of their own besides the --labels-column, or extract them with a discovery --schema-mode")
+	f.StringToStringVar(&multiValueHandlings, "multi-value-handling", multiValueHandlings, "Set how label dimensions with several values are stored, e.g. 'tags=SORTED_SET' (SORTED_ARRAY, SORTED_SET or ARRAY)")
+	f.StringVar(&schemaMode, "schema-mode", schemaMode, "How Druid gets the dimensions: 'explicit' (labels discovered from Prometheus), 'discovery' (discovered by Druid from the fields) or 'schema-discovery' (discovered with types and the labels as json column, needs Druid 26 or newer)")
+	f.StringSliceVar(&dimensionExclusions, "dimension-exclusions", dimensionExclusions, "Never discover these columns as dimensions with a discovery --schema-mode")
+}
+
+// discoversLabels reports whether the labels are discovered from Prometheus.
+// With a labels column or a discovery schema mode only the promoted labels are
+// extracted.
+func discoversLabels() bool {
+	return labelsColumn == "" && schemaMode == string(ingestion.SchemaModeExplicit)
+}
+
+// sortedKeys returns the keys of m in order.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// dimensionOptions returns the options for the dimension schema flags. They
+// have to be applied after the labels are renamed.
+func dimensionOptions() []ingestion.KafkaIngestionSpecOptions {
+	var opts []ingestion.KafkaIngestionSpecOptions
+	for _, name := range sortedKeys(dimensionTypes) {
+		opts = append(opts, ingestion.SetDimensionType(name, dimensionTypes[name]))
+	}
+	if len(noBitmapIndex) > 0 {
+		opts = append(opts, ingestion.DisableBitmapIndex(noBitmapIndex...))
+	}
+	for _, name := range sortedKeys(multiValueHandlings) {
+		opts = append(opts, ingestion.SetMultiValueHandling(name, multiValueHandlings[name]))
+	}
+	return opts
+}
+
+// schemaModeOptions returns the option for the schema mode flags. It has to be
+// applied after all other options.
+func schemaModeOptions() ([]ingestion.KafkaIngestionSpecOptions, error) {
+	mode, err := ingestion.ParseSchemaMode(schemaMode)
+	if err != nil {
+		return nil, err
+	}
+	if mode == ingestion.SchemaModeExplicit {
+		if len(dimensionExclusions) > 0 {
+			return nil, fmt.Errorf("dimension exclusions need a discovery schema mode")
+		}
+		return nil, nil
+	}
+	if labelsColumn != "" {
+		return nil, fmt.Errorf("a labels column is not supported with schema mode %q", mode)
+	}
+	if len(dimensionTypes) > 0 || len(noBitmapIndex) > 0 || len(multiValueHandlings) > 0 {
+		return nil, fmt.Errorf("dimension schemas are not supported with schema mode %q", mode)
+	}
+	return []ingestion.KafkaIngestionSpecOptions{ingestion.SetSchemaMode(mode, dimensionExclusions...)}, nil
+}
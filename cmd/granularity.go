@@ -0,0 +1,82 @@
+/*
+Copyright 2020 noris network AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"time"
+	// Druid accepts the time zones of the IANA database, which isn't
+	// installed in the container image.
+	_ "time/tzdata"
+
+	ingestion "github.com/noris-network/prometheus-druid-ingestion"
+	"github.com/spf13/cobra"
+)
+
+var (
+	segmentGranularity  = "hour"
+	queryGranularity    = "minute"
+	granularityTimeZone = ""
+	rollup              = true
+	intervals           = []string{}
+)
+
+func init() {
+	f := rootCmd.PersistentFlags()
+	f.StringVar(&segmentGranularity, "segment-granularity", segmentGranularity, "The time chunks of the segments, a simple granularity like 'day' or an ISO-8601 period like 'PT6H'")
+	f.StringVar(&queryGranularity, "query-granularity", queryGranularity, "The granularity timestamps are truncated to, a simple granularity like 'none' or an ISO-8601 period like 'PT15S'")
+	f.StringVar(&granularityTimeZone, "granularity-time-zone", granularityTimeZone, "The time zone of the granularities, e.g. 'Europe/Berlin' (default UTC)")
+	f.BoolVar(&rollup, "rollup", rollup, "Combine rows with the same truncated timestamp and dimensions (--rollup=false stores every sample)")
+	f.StringSliceVar(&intervals, "intervals", intervals, "The ISO-8601 intervals of the data to ingest, e.g. '2020-01-01/2020-02-01'")
+}
+
+// checkTimeZone validates the time zone of the granularities, which is
+// otherwise only rejected by Druid when the supervisor is submitted.
+func checkTimeZone() error {
+	if granularityTimeZone == "" {
+		return nil
+	}
+	if _, err := time.LoadLocation(granularityTimeZone); err != nil {
+		return fmt.Errorf("granularity time zone: %w", err)
+	}
+	return nil
+}
+
+// granularityOptions returns the options for the granularity flags. Rollup
+// and intervals are only set if their flags were set explicitly.
+func granularityOptions(cmd *cobra.Command) ([]ingestion.KafkaIngestionSpecOptions, error) {
+	f := cmd.Flags()
+	segment, err := ingestion.ParseGranularity(segmentGranularity, granularityTimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("segment granularity: %w", err)
+	}
+	queryGran, err := ingestion.ParseGranularity(queryGranularity, granularityTimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("query granularity: %w", err)
+	}
+	opts := []ingestion.KafkaIngestionSpecOptions{
+		ingestion.SetSegmentGranularity(segment),
+		ingestion.SetQueryGranularity(queryGran),
+	}
+	if f.Changed("rollup") {
+		opts = append(opts, ingestion.SetRollup(rollup))
+	}
+	if f.Changed("intervals") {
+		opts = append(opts, ingestion.SetIntervals(intervals...))
+	}
+	return opts, nil
+}
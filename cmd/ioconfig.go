@@ -0,0 +1,154 @@
+/*
+Copyright 2020 noris network AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"time"
+
+	ingestion "github.com/noris-network/prometheus-druid-ingestion"
+	"github.com/spf13/cobra"
+)
+
+var (
+	topicPattern                = ""
+	replicas                    = 0
+	taskCount                   = 0
+	taskDuration                = "PT10M"
+	startDelay                  = ""
+	period                      = ""
+	useEarliestOffset           = true
+	completionTimeout           = ""
+	lateMessageRejectionPeriod  = ""
+	earlyMessageRejectionPeriod = ""
+	pollTimeout                 = int64(0)
+
+	autoScaler                               = false
+	autoScalerTaskCountMin                   = 1
+	autoScalerTaskCountMax                   = 0
+	autoScalerTaskCountStart                 = 0
+	autoScalerScaleOutThreshold              = int64(0)
+	autoScalerScaleInThreshold               = int64(0)
+	autoScalerTriggerScaleOutFraction        = 0.0
+	autoScalerTriggerScaleInFraction         = 0.0
+	autoScalerScaleOutStep                   = 0
+	autoScalerScaleInStep                    = 0
+	autoScalerLagCollectionInterval          = time.Duration(0)
+	autoScalerLagCollectionRange             = time.Duration(0)
+	autoScalerScaleActionStartDelay          = time.Duration(0)
+	autoScalerScaleActionPeriod              = time.Duration(0)
+	autoScalerMinTriggerScaleActionFrequency = time.Duration(0)
+)
+
+func init() {
+	f := rootCmd.PersistentFlags()
+	f.StringVar(&topicPattern, "topic-pattern", topicPattern, "A regular expression matching the Kafka topics to ingest data from, instead of --kafka-topic")
+	f.IntVar(&replicas, "replicas", replicas, "The number of replica sets of indexing tasks")
+	f.IntVar(&taskCount, "task-count", taskCount, "The maximum number of reading tasks in a replica set")
+	f.StringVar(&taskDuration, "task-duration", taskDuration, "The ISO-8601 period after which tasks stop reading and publish their segments")
+	f.StringVar(&startDelay, "start-delay", startDelay, "The ISO-8601 period to wait before the supervisor starts managing tasks")
+	f.StringVar(&period, "period", period, "The ISO-8601 period of how often the supervisor executes its management logic")
+	f.BoolVar(&useEarliestOffset, "use-earliest-offset", useEarliestOffset, "Start reading from the earliest instead of the latest offset when the supervisor is created")
+	f.StringVar(&completionTimeout, "completion-timeout", completionTimeout, "The ISO-8601 period to wait for publishing tasks before they are declared as failed")
+	f.StringVar(&lateMessageRejectionPeriod, "late-message-rejection-period", lateMessageRejectionPeriod, "Reject messages older than this ISO-8601 period before the task was created")
+	f.StringVar(&earlyMessageRejectionPeriod, "early-message-rejection-period", earlyMessageRejectionPeriod, "Reject messages later than this ISO-8601 period after the task reached its task duration")
+	f.Int64Var(&pollTimeout, "poll-timeout", pollTimeout, "Milliseconds to wait for the Kafka consumer to poll records")
+
+	f.BoolVar(&autoScaler, "autoscaler", autoScaler, "Scale the task count with the consumer lag")
+	f.IntVar(&autoScalerTaskCountMin, "autoscaler-task-count-min", autoScalerTaskCountMin, "The minimum number of tasks of the autoscaler")
+	f.IntVar(&autoScalerTaskCountMax, "autoscaler-task-count-max", autoScalerTaskCountMax, "The maximum number of tasks of the autoscaler")
+	f.IntVar(&autoScalerTaskCountStart, "autoscaler-task-count-start", autoScalerTaskCountStart, "The number of tasks the autoscaler starts with")
+	f.Int64Var(&autoScalerScaleOutThreshold, "autoscaler-scale-out-threshold", autoScalerScaleOutThreshold, "The consumer lag above which tasks are added")
+	f.Int64Var(&autoScalerScaleInThreshold, "autoscaler-scale-in-threshold", autoScalerScaleInThreshold, "The consumer lag below which tasks are removed")
+	f.Float64Var(&autoScalerTriggerScaleOutFraction, "autoscaler-trigger-scale-out-fraction", autoScalerTriggerScaleOutFraction, "The fraction of lag samples above the scale out threshold that triggers scaling out")
+	f.Float64Var(&autoScalerTriggerScaleInFraction, "autoscaler-trigger-scale-in-fraction", autoScalerTriggerScaleInFraction, "The fraction of lag samples below the scale in threshold that triggers scaling in")
+	f.IntVar(&autoScalerScaleOutStep, "autoscaler-scale-out-step", autoScalerScaleOutStep, "The number of tasks added per scale out action")
+	f.IntVar(&autoScalerScaleInStep, "autoscaler-scale-in-step", autoScalerScaleInStep, "The number of tasks removed per scale in action")
+	f.DurationVar(&autoScalerLagCollectionInterval, "autoscaler-lag-collection-interval", autoScalerLagCollectionInterval, "How often the consumer lag is collected")
+	f.DurationVar(&autoScalerLagCollectionRange, "autoscaler-lag-collection-range", autoScalerLagCollectionRange, "The time window of lag samples considered for scale actions")
+	f.DurationVar(&autoScalerScaleActionStartDelay, "autoscaler-scale-action-start-delay", autoScalerScaleActionStartDelay, "The delay after the supervisor starts before scale actions are taken")
+	f.DurationVar(&autoScalerScaleActionPeriod, "autoscaler-scale-action-period", autoScalerScaleActionPeriod, "How often scale actions are considered")
+	f.DurationVar(&autoScalerMinTriggerScaleActionFrequency, "autoscaler-min-trigger-scale-action-frequency", autoScalerMinTriggerScaleActionFrequency, "The minimum time between two scale actions")
+}
+
+// ioConfigOptions returns the options for the ioConfig flags that were set
+// explicitly, leaving Druid's defaults otherwise.
+func ioConfigOptions(cmd *cobra.Command) []ingestion.KafkaIngestionSpecOptions {
+	f := cmd.Flags()
+	opts := []ingestion.KafkaIngestionSpecOptions{
+		ingestion.SetTaskDuration(taskDuration),
+		ingestion.SetUseEarliestOffset(useEarliestOffset),
+	}
+	add := func(name string, opt ingestion.KafkaIngestionSpecOptions) {
+		if f.Changed(name) {
+			opts = append(opts, opt)
+		}
+	}
+	add("topic-pattern", ingestion.SetTopicPattern(topicPattern))
+	add("replicas", ingestion.SetReplicas(replicas))
+	add("task-count", ingestion.SetTaskCount(taskCount))
+	add("start-delay", ingestion.SetStartDelay(startDelay))
+	add("period", ingestion.SetPeriod(period))
+	add("completion-timeout", ingestion.SetCompletionTimeout(completionTimeout))
+	add("late-message-rejection-period", ingestion.SetLateMessageRejectionPeriod(lateMessageRejectionPeriod))
+	add("early-message-rejection-period", ingestion.SetEarlyMessageRejectionPeriod(earlyMessageRejectionPeriod))
+	add("poll-timeout", ingestion.SetPollTimeout(pollTimeout))
+	if autoScaler {
+		opts = append(opts, ingestion.SetAutoScalerConfig(autoScalerConfig(cmd)))
+	}
+	return opts
+}
+
+// autoScalerConfig builds an AutoScalerConfig from the autoscaler flags.
+// Optional settings are only set if their flags were set explicitly.
+func autoScalerConfig(cmd *cobra.Command) ingestion.AutoScalerConfig {
+	f := cmd.Flags()
+	cfg := ingestion.AutoScalerConfig{
+		TaskCountMin: autoScalerTaskCountMin,
+		TaskCountMax: autoScalerTaskCountMax,
+	}
+	setInt := func(name string, v int, dst **int) {
+		if f.Changed(name) {
+			*dst = &v
+		}
+	}
+	setInt64 := func(name string, v int64, dst **int64) {
+		if f.Changed(name) {
+			*dst = &v
+		}
+	}
+	setFloat64 := func(name string, v float64, dst **float64) {
+		if f.Changed(name) {
+			*dst = &v
+		}
+	}
+	setMillis := func(name string, v time.Duration, dst **int64) {
+		setInt64(name, v.Milliseconds(), dst)
+	}
+	setInt("autoscaler-task-count-start", autoScalerTaskCountStart, &cfg.TaskCountStart)
+	setInt64("autoscaler-scale-out-threshold", autoScalerScaleOutThreshold, &cfg.ScaleOutThreshold)
+	setInt64("autoscaler-scale-in-threshold", autoScalerScaleInThreshold, &cfg.ScaleInThreshold)
+	setFloat64("autoscaler-trigger-scale-out-fraction", autoScalerTriggerScaleOutFraction, &cfg.TriggerScaleOutFractionThreshold)
+	setFloat64("autoscaler-trigger-scale-in-fraction", autoScalerTriggerScaleInFraction, &cfg.TriggerScaleInFractionThreshold)
+	setInt("autoscaler-scale-out-step", autoScalerScaleOutStep, &cfg.ScaleOutStep)
+	setInt("autoscaler-scale-in-step", autoScalerScaleInStep, &cfg.ScaleInStep)
+	setMillis("autoscaler-lag-collection-interval", autoScalerLagCollectionInterval, &cfg.LagCollectionIntervalMillis)
+	setMillis("autoscaler-lag-collection-range", autoScalerLagCollectionRange, &cfg.LagCollectionRangeMillis)
+	setMillis("autoscaler-scale-action-start-delay", autoScalerScaleActionStartDelay, &cfg.ScaleActionStartDelayMillis)
+	setMillis("autoscaler-scale-action-period", autoScalerScaleActionPeriod, &cfg.ScaleActionPeriodMillis)
+	setMillis("autoscaler-min-trigger-scale-action-frequency", autoScalerMinTriggerScaleActionFrequency, &cfg.MinTriggerScaleActionFrequencyMillis)
+	return cfg
+}
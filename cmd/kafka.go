@@ -0,0 +1,135 @@
+/*
+Copyright 2020 noris network AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	ingestion "github.com/noris-network/prometheus-druid-ingestion"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var (
+	sslConfig                          = ingestion.DefaultSSLConfig()
+	sslEndpointIdentificationAlgorithm = ""
+	saslConfig                         = ingestion.SASLConfig{JAASConfigVariable: "DRUID_KAFKA_JAAS_CONFIG"}
+	consumerProperties                 = []string{}
+	clientPropertiesFile               = ""
+	clientPropertiesPrefix             = "DRUID_KAFKA_"
+	clientPropertiesHint               sync.Once
+)
+
+func init() {
+	f := rootCmd.PersistentFlags()
+	f.StringVar(&sslConfig.TruststoreType, "kafka-ssl-truststore-type", sslConfig.TruststoreType, "The type of the truststore, e.g. 'PKCS12' or 'JKS'")
+	f.StringVar(&sslConfig.TruststoreLocation, "kafka-ssl-truststore-location", sslConfig.TruststoreLocation, "The location of the truststore on the Druid nodes")
+	f.StringVar(&sslConfig.TruststorePasswordVariable, "kafka-ssl-truststore-password-env", sslConfig.TruststorePasswordVariable, "The environment variable holding the truststore password on the Druid nodes")
+	f.StringVar(&sslConfig.KeystoreType, "kafka-ssl-keystore-type", sslConfig.KeystoreType, "The type of the keystore, e.g. 'PKCS12' or 'JKS'")
+	f.StringVar(&sslConfig.KeystoreLocation, "kafka-ssl-keystore-location", sslConfig.KeystoreLocation, "The location of the keystore on the Druid nodes (no client certificate is used if empty)")
+	f.StringVar(&sslConfig.KeystorePasswordVariable, "kafka-ssl-keystore-password-env", sslConfig.KeystorePasswordVariable, "The environment variable holding the keystore password on the Druid nodes")
+	f.StringVar(&sslConfig.KeyPasswordVariable, "kafka-ssl-key-password-env", sslConfig.KeyPasswordVariable, "The environment variable holding the password of the private key on the Druid nodes")
+	f.StringVar(&sslConfig.EnabledProtocols, "kafka-ssl-enabled-protocols", sslConfig.EnabledProtocols, "The protocols enabled for SSL connections, e.g. 'TLSv1.2,TLSv1.3'")
+	f.StringVar(&saslConfig.Mechanism, "kafka-sasl-mechanism", saslConfig.Mechanism, "Enables SASL authentication with this mechanism, e.g. 'SCRAM-SHA-512' or 'PLAIN'")
+	f.StringVar(&saslConfig.JAASConfigVariable, "kafka-sasl-jaas-config-env", saslConfig.JAASConfigVariable, "The environment variable holding the SASL JAAS config, including the password, on the Druid nodes")
+	f.StringVar(&clientPropertiesFile, "kafka-client-properties", clientPropertiesFile, "Import the consumer properties from a Java Kafka client.properties file")
+	f.StringVar(&clientPropertiesPrefix, "kafka-client-properties-env-prefix", clientPropertiesPrefix, "The prefix of the environment variables secrets of the client.properties file are read from on the Druid nodes")
+	f.StringArrayVar(&consumerProperties, "consumer-property", consumerProperties, "Set an additional Kafka consumer property as key=value (repeatable)")
+	f.StringVar(&sslEndpointIdentificationAlgorithm, "kafka-ssl-endpoint-identification-algorithm", sslEndpointIdentificationAlgorithm, "The endpoint identification algorithm, e.g. 'https' (an explicitly empty value disables hostname verification)")
+}
+
+// kafkaOptions returns the options configuring the Kafka consumer from the
+// kafka flags. The settings of a client.properties file are applied first, so
+// flags set explicitly take precedence. The default SSL config is not applied
+// on top of a client.properties file.
+func kafkaOptions(cmd *cobra.Command) ([]ingestion.KafkaIngestionSpecOptions, error) {
+	var opts []ingestion.KafkaIngestionSpecOptions
+	applySSL := ingestSSL
+	if clientPropertiesFile != "" {
+		props, err := readClientProperties()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, ingestion.SetClientProperties(props, clientPropertiesPrefix))
+		if cmd.Flags().Changed("kafka-brokers") {
+			opts = append(opts, ingestion.SetBrokers(kafkaBrokers))
+		}
+		applySSL = ingestSSL && sslFlagsChanged(cmd)
+	}
+	if applySSL {
+		cfg := sslConfig
+		if cmd.Flags().Changed("kafka-ssl-endpoint-identification-algorithm") {
+			cfg.EndpointIdentificationAlgorithm = &sslEndpointIdentificationAlgorithm
+		}
+		opts = append(opts, ingestion.SetSSLConfig(cfg))
+	}
+	if saslConfig.Mechanism != "" {
+		opts = append(opts, ingestion.SetSASLConfig(saslConfig))
+	}
+	for _, p := range consumerProperties {
+		kv := strings.SplitN(p, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid consumer property %q, expected key=value", p)
+		}
+		opts = append(opts, ingestion.SetConsumerProperty(kv[0], kv[1]))
+	}
+	return opts, nil
+}
+
+// sslFlagsChanged reports whether any of the SSL flags was set explicitly.
+func sslFlagsChanged(cmd *cobra.Command) bool {
+	changed := cmd.Flags().Changed("ingest-via-ssl")
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		if strings.HasPrefix(f.Name, "kafka-ssl-") {
+			changed = true
+		}
+	})
+	return changed
+}
+
+// readClientProperties reads the client.properties file and tells once which
+// environment variables the secrets are read from.
+func readClientProperties() (map[string]string, error) {
+	f, err := os.Open(clientPropertiesFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading client properties: %w", err)
+	}
+	defer f.Close()
+	props, err := ingestion.ParseJavaProperties(f)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %q: %w", clientPropertiesFile, err)
+	}
+
+	clientPropertiesHint.Do(func() {
+		keys := make([]string, 0, len(props))
+		for k := range props {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if ingestion.IsSecretClientProperty(k) {
+				fmt.Fprintf(os.Stderr, "Set %s on the Druid nodes to the value of %s\n",
+					ingestion.ClientPropertyVariable(clientPropertiesPrefix, k), k)
+			}
+		}
+	})
+	return props, nil
+}
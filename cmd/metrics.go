@@ -0,0 +1,120 @@
+/*
+Copyright 2020 noris network AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	ingestion "github.com/noris-network/prometheus-druid-ingestion"
+)
+
+var (
+	defaultMetricsOnly = false
+	metrics            = []string{}
+	noDefaultMetrics   = false
+
+	quantilesSketch    = false
+	quantilesSketchK   = 0
+	distinctSketches   = []string{}
+	distinctSketchType = "hll"
+	distinctSketchSize = 0
+)
+
+func init() {
+	f := rootCmd.PersistentFlags()
+	f.StringArrayVar(&metrics, "metric", metrics, "Add a metric given as name:type[:field], e.g. 'value_sum:doubleSum' (repeatable, the field defaults to 'value')")
+	f.BoolVar(&noDefaultMetrics, "no-default-metrics", noDefaultMetrics, "Replace the default 'count' and 'value' metrics and the aggregators by metric type with the metrics given by --metric")
+	f.BoolVar(&quantilesSketch, "quantiles-sketch", quantilesSketch, "Add a quantiles sketch of the values called 'value_sketch' (needs the druid-datasketches extension)")
+	f.IntVar(&quantilesSketchK, "quantiles-sketch-k", quantilesSketchK, "The size and accuracy of the quantiles sketch, a power of 2 from 2 to 32768 (default of Druid 128)")
+	f.StringSliceVar(&distinctSketches, "distinct-count-sketch", distinctSketches, "Add a distinct count sketch of the values of these labels (needs the druid-datasketches extension)")
+	f.StringVar(&distinctSketchType, "distinct-count-sketch-type", distinctSketchType, "The type of the distinct count sketches, either 'hll' or 'theta'")
+	f.IntVar(&distinctSketchSize, "distinct-count-sketch-size", distinctSketchSize, "The lgK of HLL sketches (4 to 21, default of Druid 12) or the size of theta sketches (a power of 2, default of Druid 16384)")
+	f.BoolVar(&defaultMetricsOnly, "default-metrics-only", defaultMetricsOnly, "Only use the default 'count' and 'value' metrics instead of adding aggregators suited to counters and gauges from the Prometheus metadata API")
+}
+
+// metricOptions returns the options for the metric flags.
+func metricOptions() ([]ingestion.KafkaIngestionSpecOptions, error) {
+	parsed := make([]ingestion.Metric, 0, len(metrics))
+	for _, s := range metrics {
+		m, err := ingestion.ParseMetric(s)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, m)
+	}
+	if noDefaultMetrics {
+		return []ingestion.KafkaIngestionSpecOptions{ingestion.SetMetrics(parsed...)}, nil
+	}
+	return []ingestion.KafkaIngestionSpecOptions{ingestion.AddMetrics(parsed...)}, nil
+}
+
+// sketchOptions returns the options for the sketch flags. They have to be
+// applied after the labels are renamed.
+func sketchOptions() ([]ingestion.KafkaIngestionSpecOptions, error) {
+	var opts []ingestion.KafkaIngestionSpecOptions
+	if quantilesSketch {
+		opts = append(opts, ingestion.AddQuantilesSketch(quantilesSketchK))
+	}
+	if len(distinctSketches) > 0 {
+		t, err := ingestion.ParseSketchType(distinctSketchType)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, ingestion.AddDistinctCountSketches(t, distinctSketchSize, distinctSketches...))
+	}
+	return opts, nil
+}
+
+// metricTypeOptions looks up the types of the metrics selected by the query
+// in the Prometheus metadata API. They are left out with the
+// default-metrics-only and no-default-metrics flags, and if the labels are
+// not discovered from Prometheus either.
+func metricTypeOptions(ctx context.Context) ([]ingestion.KafkaIngestionSpecOptions, error) {
+	if defaultMetricsOnly || noDefaultMetrics || !discoversLabels() {
+		return nil, nil
+	}
+	v1api, err := prometheusAPI()
+	if err != nil {
+		return nil, err
+	}
+
+	end := time.Now()
+	names, warnings, err := v1api.LabelValues(ctx, "__name__", []string{query}, end.Add(-discoveryWindow), end)
+	if err != nil {
+		return nil, fmt.Errorf("querying Prometheus metric names: %w", err)
+	}
+	printWarnings(warnings)
+	metadata, err := v1api.Metadata(ctx, "", "")
+	if err != nil {
+		return nil, fmt.Errorf("querying Prometheus metadata: %w", err)
+	}
+
+	families := make(map[string]ingestion.MetricType, len(metadata))
+	for name, m := range metadata {
+		if len(m) > 0 {
+			families[name] = ingestion.MetricType(m[0].Type)
+		}
+	}
+	metricNames := make([]string, len(names))
+	for i, n := range names {
+		metricNames[i] = string(n)
+	}
+	types := ingestion.ResolveMetricTypes(metricNames, families)
+	return []ingestion.KafkaIngestionSpecOptions{ingestion.SetMetricTypes(types)}, nil
+}
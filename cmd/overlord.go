@@ -0,0 +1,75 @@
+/*
+Copyright 2020 noris network AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	ingestion "github.com/noris-network/prometheus-druid-ingestion"
+	"github.com/spf13/cobra"
+)
+
+var (
+	overlordAddress       = "http://druid-overlord:8090"
+	overlordUsername      = ""
+	overlordPassword      = ""
+	overlordCAFile        = ""
+	overlordTLSSkipVerify = false
+)
+
+// addOverlordFlags adds the flags needed to connect to the Druid Overlord to
+// cmd.
+func addOverlordFlags(cmd *cobra.Command) {
+	f := cmd.Flags()
+	f.StringVar(&overlordAddress, "overlord-address", overlordAddress, "The address of the Druid Overlord")
+	f.StringVar(&overlordUsername, "overlord-username", overlordUsername, "The username for basic auth against the Druid Overlord")
+	f.StringVar(&overlordPassword, "overlord-password", overlordPassword, "The password for basic auth against the Druid Overlord (defaults to $DRUID_OVERLORD_PASSWORD)")
+	f.StringVar(&overlordCAFile, "overlord-ca-file", overlordCAFile, "A PEM encoded CA bundle used to verify the Druid Overlord's certificate")
+	f.BoolVar(&overlordTLSSkipVerify, "overlord-tls-skip-verify", overlordTLSSkipVerify, "Skip TLS certificate verification of the Druid Overlord")
+}
+
+// overlordClient returns an OverlordClient configured by the overlord flags.
+func overlordClient() (*ingestion.OverlordClient, error) {
+	opts := []ingestion.OverlordClientOptions{
+		ingestion.SetInsecureSkipVerify(overlordTLSSkipVerify),
+	}
+
+	password := overlordPassword
+	if password == "" {
+		password = os.Getenv("DRUID_OVERLORD_PASSWORD")
+	}
+	if overlordUsername != "" {
+		opts = append(opts, ingestion.SetBasicAuth(overlordUsername, password))
+	}
+
+	if overlordCAFile != "" {
+		pem, err := ioutil.ReadFile(overlordCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %q", overlordCAFile)
+		}
+		opts = append(opts, ingestion.SetRootCAs(pool))
+	}
+
+	return ingestion.NewOverlordClient(overlordAddress, opts...), nil
+}
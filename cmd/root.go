@@ -20,6 +20,7 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net"
@@ -30,6 +31,7 @@ import (
 	ingestion "github.com/noris-network/prometheus-druid-ingestion"
 	"github.com/prometheus/client_golang/api"
 	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
 	"github.com/spf13/cobra"
 )
 
@@ -43,6 +45,17 @@ var (
 	kafkaTopic      = "prometheus"
 	kafkaBrokers    = "kafka01:9092,kafka02:9092,kafka03:9092"
 	ingestSSL       = true
+	specMode        = string(ingestion.SpecModeLegacy)
+	queryRange      = time.Duration(0)
+	queryStep       = 5 * time.Minute
+	discovery       = "query"
+	discoveryWindow = 24 * time.Hour
+	labelInclude    = []string{}
+	labelExclude    = []string{}
+	labelRequire    = []string{}
+	maxCardinality  = 0
+	minCoverage     = 0.0
+	collisionPrefix = ""
 	rootCmd         = &cobra.Command{
 		Use:   "generate-ingestion",
 		Short: "Generate an Druid.io opinionated ingestion spec from a Prometheus query result",
@@ -51,16 +64,28 @@ var (
 )
 
 func init() {
-	f := rootCmd.Flags()
+	rootCmd.Flags().BoolVarP(&toStdout, "toStdout", "o", toStdout, "Prints the JSON ingestion spec to STDOUT")
+	rootCmd.Flags().StringVarP(&outputFile, "file", "f", outputFile, "The file to save the ingestion spec to")
+
+	f := rootCmd.PersistentFlags()
 	f.StringVarP(&address, "address", "a", address, "The address of the Prometheus server to send the query to")
 	f.StringVarP(&query, "query", "q", query, "The query to send to the Prometheus server")
 	f.BoolVar(&tlsSkipVerify, "tls-skip-verify", tlsSkipVerify, "Skip TLS certificate verification")
-	f.BoolVarP(&toStdout, "toStdout", "o", toStdout, "Prints the JSON ingestion spec to STDOUT")
-	f.StringVarP(&outputFile, "file", "f", outputFile, "The file to save the ingestion spec to")
+	f.DurationVar(&queryRange, "range", queryRange, "Send a range query over the given duration up to now instead of an instant query, e.g. 24h")
+	f.DurationVar(&queryStep, "step", queryStep, "The resolution of the range query")
+	f.StringVar(&discovery, "discovery", discovery, "How labels are discovered: 'query' (instant query), 'series' (series API) or 'labels' (labels API, Prometheus >= 2.24)")
+	f.DurationVar(&discoveryWindow, "discovery-window", discoveryWindow, "The time window searched by the 'series' and 'labels' discovery")
+	f.StringArrayVar(&labelInclude, "label-include", labelInclude, "Only use labels matching this regular expression as dimensions (repeatable)")
+	f.StringArrayVar(&labelExclude, "label-exclude", labelExclude, "Never use labels matching this regular expression as dimensions (repeatable)")
+	f.StringSliceVar(&labelRequire, "label-require", labelRequire, "Always use these labels as dimensions, even if they weren't discovered")
+	f.IntVar(&maxCardinality, "max-cardinality", maxCardinality, "Drop labels with more distinct values than this (0 disables the check)")
+	f.Float64Var(&minCoverage, "min-coverage", minCoverage, "Drop labels present on less than this ratio of series, between 0 and 1")
+	f.StringVar(&collisionPrefix, "label-collision-prefix", collisionPrefix, "Prefix the columns of labels colliding with reserved columns like 'name' or 'value', e.g. 'label_' (collisions are an error if unset)")
 	f.StringVarP(&druidDataSource, "druid-data-source", "d", druidDataSource, "The druid data source")
 	f.StringVarP(&kafkaTopic, "kafka-topic", "t", kafkaTopic, "The Kafka topic for druid to ingest data from")
 	f.StringVarP(&kafkaBrokers, "kafka-brokers", "b", kafkaBrokers, "The Kafka brokers for druid to ingest data from")
 	f.BoolVar(&ingestSSL, "ingest-via-ssl", ingestSSL, "Enables data ingestion from Kafka to Druid via SSL")
+	f.StringVar(&specMode, "spec-mode", specMode, "The layout of the ingestion spec, either 'legacy' (parser) or 'modern' (inputFormat)")
 }
 
 func Run() {
@@ -71,6 +96,186 @@ func Run() {
 }
 
 func run(cmd *cobra.Command, args []string) {
+	spec, err := buildSpec(cmd)
+	if err != nil {
+		fmt.Printf("Error building ingestion spec: %v\n", err)
+		os.Exit(1)
+	}
+	jsonSpec, err := json.MarshalIndent(spec, "", "    ")
+	if err != nil {
+		fmt.Printf("Error marshalling ingestion spec: %v\n", err)
+		os.Exit(1)
+	}
+
+	if toStdout {
+		fmt.Println(string(jsonSpec))
+	}
+	if outputFile != "" {
+		if err = ioutil.WriteFile(outputFile, jsonSpec, os.FileMode(0644)); err != nil {
+			fmt.Printf("Error writing %q: %v", outputFile, err)
+			os.Exit(1)
+		}
+	}
+}
+
+// buildSpec queries Prometheus and builds an ingestion spec from the labels of
+// the result and the flags passed to cmd. Prometheus isn't queried for labels
+// with a labels column or a discovery schema mode.
+func buildSpec(cmd *cobra.Command) (*ingestion.KafkaIngestionSpec, error) {
+	if err := checkFlags(cmd); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	l, err := queryLabels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	metricOpts, err := metricTypeOptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return newSpec(cmd, l, metricOpts...)
+}
+
+// queryLabels discovers the unique labels of the series selected by the query.
+func queryLabels(ctx context.Context) (ingestion.LabelSet, error) {
+	// All labels are stored in the labels column or discovered by Druid, only
+	// the promoted labels need flatten fields of their own.
+	if !discoversLabels() {
+		return ingestion.LabelSet{}.Union(promoteLabels), nil
+	}
+
+	v1api, err := prometheusAPI()
+	if err != nil {
+		return nil, err
+	}
+
+	var l ingestion.LabelSet
+	switch {
+	case maxCardinality > 0 || minCoverage > 0:
+		report, err := analyzeCardinality(ctx, v1api)
+		if err != nil {
+			return nil, err
+		}
+		l = report.Select(maxCardinality, minCoverage)
+	case discovery == "query":
+		result, err := runQuery(ctx, v1api)
+		if err != nil {
+			return nil, err
+		}
+		l, err = ingestion.ExtractUniqueLabels(result)
+		if err != nil {
+			return nil, fmt.Errorf("extracting labels: %w", err)
+		}
+	case discovery == "series":
+		series, err := runSeries(ctx, v1api)
+		if err != nil {
+			return nil, err
+		}
+		l = ingestion.ExtractUniqueLabelsFromSeries(series)
+	case discovery == "labels":
+		end := time.Now()
+		names, warnings, err := v1api.LabelNames(ctx, []string{query}, end.Add(-discoveryWindow), end)
+		if err != nil {
+			return nil, fmt.Errorf("querying Prometheus label names: %w", err)
+		}
+		printWarnings(warnings)
+		l = ingestion.LabelSetFromNames(names)
+	default:
+		return nil, fmt.Errorf("unknown discovery %q", discovery)
+	}
+
+	filter, err := labelFilter()
+	if err != nil {
+		return nil, err
+	}
+	return filter.Apply(l), nil
+}
+
+// analyzeCardinality computes the cardinality of the labels of the series
+// selected by the query. The 'labels' discovery doesn't return label values
+// and is not supported.
+func analyzeCardinality(ctx context.Context, v1api v1.API) (*ingestion.CardinalityReport, error) {
+	switch discovery {
+	case "query":
+		result, err := runQuery(ctx, v1api)
+		if err != nil {
+			return nil, err
+		}
+		report, err := ingestion.AnalyzeCardinality(result)
+		if err != nil {
+			return nil, fmt.Errorf("analyzing cardinality: %w", err)
+		}
+		return report, nil
+	case "series":
+		series, err := runSeries(ctx, v1api)
+		if err != nil {
+			return nil, err
+		}
+		return ingestion.AnalyzeSeriesCardinality(series), nil
+	default:
+		return nil, fmt.Errorf("cardinality analysis is not supported with discovery %q", discovery)
+	}
+}
+
+// runQuery sends the query to Prometheus, either as instant or range query.
+func runQuery(ctx context.Context, v1api v1.API) (model.Value, error) {
+	var (
+		result   model.Value
+		warnings v1.Warnings
+		err      error
+		end      = time.Now()
+	)
+	if queryRange > 0 {
+		result, warnings, err = v1api.QueryRange(ctx, query, v1.Range{
+			Start: end.Add(-queryRange),
+			End:   end,
+			Step:  queryStep,
+		})
+	} else {
+		result, warnings, err = v1api.Query(ctx, query, end)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("querying Prometheus: %w", err)
+	}
+	printWarnings(warnings)
+	return result, nil
+}
+
+// runSeries fetches the series selected by the query from the series API.
+func runSeries(ctx context.Context, v1api v1.API) ([]model.LabelSet, error) {
+	end := time.Now()
+	series, warnings, err := v1api.Series(ctx, []string{query}, end.Add(-discoveryWindow), end)
+	if err != nil {
+		return nil, fmt.Errorf("querying Prometheus series: %w", err)
+	}
+	printWarnings(warnings)
+	return series, nil
+}
+
+// printWarnings prints warnings returned by the Prometheus API to stderr.
+func printWarnings(warnings v1.Warnings) {
+	if len(warnings) > 0 {
+		fmt.Fprintf(os.Stderr, "Warnings: %v\n", warnings)
+	}
+}
+
+// labelFilter returns a LabelFilter configured by the label flags.
+func labelFilter() (*ingestion.LabelFilter, error) {
+	filter, err := ingestion.NewLabelFilter(
+		ingestion.IncludeLabels(labelInclude...),
+		ingestion.ExcludeLabels(labelExclude...),
+		ingestion.RequireLabels(labelRequire...),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("creating label filter: %w", err)
+	}
+	return filter, nil
+}
+
+// prometheusAPI returns a client for the Prometheus HTTP API.
+func prometheusAPI() (v1.API, error) {
 	rt := &http.Transport{
 		Proxy: http.ProxyFromEnvironment,
 		DialContext: (&net.Dialer{
@@ -87,24 +292,102 @@ func run(cmd *cobra.Command, args []string) {
 		RoundTripper: rt,
 	})
 	if err != nil {
-		fmt.Printf("Error creating client: %v\n", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("creating client: %w", err)
 	}
-	v1api := v1.NewAPI(client)
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-	result, warnings, err := v1api.Query(ctx, fmt.Sprintf(`%s`, query), time.Now())
+	return v1.NewAPI(client), nil
+}
+
+// checkFlags validates the flags used for building the spec without talking to
+// Prometheus.
+func checkFlags(cmd *cobra.Command) error {
+	switch discovery {
+	case "query", "series", "labels":
+	default:
+		return fmt.Errorf("unknown discovery %q", discovery)
+	}
+	if queryRange > 0 && queryStep <= 0 {
+		return fmt.Errorf("step must be positive")
+	}
+	if queryRange > 0 && discovery != "query" {
+		return fmt.Errorf("range queries are not supported with discovery %q, use --discovery-window instead", discovery)
+	}
+	if maxCardinality < 0 {
+		return fmt.Errorf("max cardinality must not be negative")
+	}
+	if minCoverage < 0 || minCoverage > 1 {
+		return fmt.Errorf("min coverage must be between 0 and 1")
+	}
+	if (maxCardinality > 0 || minCoverage > 0) && discovery == "labels" {
+		return fmt.Errorf("cardinality limits are not supported with discovery %q", discovery)
+	}
+	mode, err := ingestion.ParseSchemaMode(schemaMode)
 	if err != nil {
-		fmt.Printf("Error querying Prometheus: %v\n", err)
-		os.Exit(1)
+		return err
 	}
-	if len(warnings) > 0 {
-		fmt.Printf("Warnings: %v\n", warnings)
+	if len(promoteLabels) > 0 && discoversLabels() {
+		return fmt.Errorf("promoted labels need a labels column or a discovery schema mode")
+	}
+	if labelsColumn != "" {
+		if err := checkNoDiscoveryFlags(cmd, "--labels-column"); err != nil {
+			return err
+		}
+	}
+	if mode != ingestion.SchemaModeExplicit {
+		if err := checkNoDiscoveryFlags(cmd, "--schema-mode "+schemaMode); err != nil {
+			return err
+		}
+	}
+	// Druid only discovers root fields, so without schema discovery the
+	// labels are only stored if they are extracted.
+	if mode == ingestion.SchemaModeDiscovery && len(promoteLabels) == 0 {
+		return fmt.Errorf("--schema-mode discovery needs the labels to store given with --promote-labels, or use --schema-mode schema-discovery to store all labels")
 	}
-	l, err := ingestion.ExtractUniqueLabels(result)
+	if _, err := labelFilter(); err != nil {
+		return err
+	}
+	if err := checkTimeZone(); err != nil {
+		return err
+	}
+	_, err = newSpec(cmd, nil)
+	// Columns of labels can only be checked once the labels are discovered.
+	// Validate checks them last, so all other errors are still reported.
+	var unknown *ingestion.UnknownColumnError
+	if errors.As(err, &unknown) {
+		return nil
+	}
+	return err
+}
+
+// discoveryFlags are the flags that only change how labels are discovered.
+var discoveryFlags = []string{
+	"discovery",
+	"discovery-window",
+	"range",
+	"step",
+	"label-include",
+	"label-exclude",
+	"label-require",
+	"max-cardinality",
+	"min-coverage",
+}
+
+// checkNoDiscoveryFlags returns an error if one of the discoveryFlags was set
+// although the given flag skips the discovery of labels.
+func checkNoDiscoveryFlags(cmd *cobra.Command, flag string) error {
+	for _, name := range discoveryFlags {
+		if cmd.Flags().Changed(name) {
+			return fmt.Errorf("--%s is not supported with %s, as no labels are discovered from Prometheus", name, flag)
+		}
+	}
+	return nil
+}
+
+// newSpec builds an ingestion spec from labels and the flags passed to cmd.
+// The extra options are applied after the options of the flags.
+func newSpec(cmd *cobra.Command, l ingestion.LabelSet, extra ...ingestion.KafkaIngestionSpecOptions) (*ingestion.KafkaIngestionSpec, error) {
+	mode, err := ingestion.ParseSpecMode(specMode)
 	if err != nil {
-		fmt.Printf("Error extracting labels: %v\n", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("parsing spec mode: %w", err)
 	}
 
 	opts := []ingestion.KafkaIngestionSpecOptions{
@@ -113,24 +396,61 @@ func run(cmd *cobra.Command, args []string) {
 		ingestion.SetBrokers(kafkaBrokers),
 		ingestion.SetLabels(l),
 	}
-	if ingestSSL {
-		opts = append(opts, ingestion.ApplySSLConfig())
+	if labelsColumn != "" {
+		opts = append(opts, ingestion.SetLabelsColumn(labelsColumn))
 	}
-
-	spec := ingestion.NewKafkaIngestionSpec(opts...)
-	jsonSpec, err := json.MarshalIndent(spec, "", "    ")
+	opts = append(opts, ingestion.SetSpecMode(mode))
+	kafkaOpts, err := kafkaOptions(cmd)
 	if err != nil {
-		fmt.Printf("Error marshalling ingestion spec: %v\n", err)
-		os.Exit(1)
+		return nil, err
+	}
+	opts = append(opts, kafkaOpts...)
+	opts = append(opts, ioConfigOptions(cmd)...)
+	granularityOpts, err := granularityOptions(cmd)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, granularityOpts...)
+	if tc := tuningConfig(cmd); tc != nil {
+		opts = append(opts, ingestion.SetTuningConfig(*tc))
+	}
+	metricOpts, err := metricOptions()
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, metricOpts...)
+	transformOpts, err := transformOptions()
+	if err != nil {
+		return nil, err
 	}
+	opts = append(opts, transformOpts...)
+	opts = append(opts, extra...)
+	opts = append(opts, ingestion.RenameCollidingLabels(collisionPrefix))
+	sketchOpts, err := sketchOptions()
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, sketchOpts...)
+	opts = append(opts, dimensionOptions()...)
+	filterOpts, err := seriesFilterOptions()
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, filterOpts...)
+	schemaModeOpts, err := schemaModeOptions()
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, schemaModeOpts...)
 
-	if toStdout {
-		fmt.Println(string(jsonSpec))
+	spec := ingestion.NewKafkaIngestionSpec(opts...)
+	err = spec.Validate()
+	var collision *ingestion.ColumnCollisionError
+	if errors.As(err, &collision) {
+		return nil, fmt.Errorf("%w (rename the labels with --label-collision-prefix)", err)
 	}
-	if outputFile != "" {
-		if err = ioutil.WriteFile(outputFile, jsonSpec, os.FileMode(0644)); err != nil {
-			fmt.Printf("Error writing %q: %v", outputFile, err)
-			os.Exit(1)
-		}
+	if err != nil {
+		return nil, err
 	}
+	return spec, nil
 }
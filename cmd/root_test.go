@@ -0,0 +1,98 @@
+/*
+Copyright 2020 noris network AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	ingestion "github.com/noris-network/prometheus-druid-ingestion"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildSpec_SchemaDiscovery(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.Error(w, "unexpected request", http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	defer func(a, m string, p []string) {
+		address, schemaMode, promoteLabels = a, m, p
+	}(address, schemaMode, promoteLabels)
+	err := rootCmd.ParseFlags([]string{"--address", srv.URL, "--schema-mode", "schema-discovery", "--promote-labels", "job"})
+	assert.NoError(t, err)
+
+	spec, err := buildSpec(rootCmd)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, requests)
+	assert.Equal(t, []string{"job"}, []string(spec.Labels()))
+	assert.Empty(t, spec.DataSchema.Parser.ParseSpec.DimensionsSpec.Dimensions)
+}
+
+func TestCheckFlags_Discovery(t *testing.T) {
+	defer func(m string, p []string) {
+		schemaMode, promoteLabels = m, p
+	}(schemaMode, promoteLabels)
+
+	// Without promoted labels no label would be stored.
+	schemaMode, promoteLabels = "discovery", nil
+	assert.Error(t, checkFlags(rootCmd))
+
+	promoteLabels = []string{"job"}
+	assert.NoError(t, checkFlags(rootCmd))
+}
+
+func TestMetricTypeOptions(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/v1/label/__name__/values":
+			fmt.Fprint(w, `{"status":"success","data":["http_requests_total","up"]}`)
+		case "/api/v1/metadata":
+			fmt.Fprint(w, `{"status":"success","data":{"http_requests_total":[{"type":"counter"}],"up":[{"type":"gauge"}]}}`)
+		default:
+			http.Error(w, "unexpected request", http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	defer func(a string, d bool) {
+		address, defaultMetricsOnly = a, d
+	}(address, defaultMetricsOnly)
+	address = srv.URL
+
+	// The aggregators are chosen by the metric types by default.
+	opts, err := metricTypeOptions(context.Background())
+	assert.NoError(t, err)
+	spec := ingestion.NewKafkaIngestionSpec(opts...)
+	assert.Len(t, spec.DataSchema.MetricsSpec, 8)
+	assert.Equal(t, "counter_last", spec.DataSchema.MetricsSpec[3].Name)
+
+	requests = 0
+	defaultMetricsOnly = true
+	opts, err = metricTypeOptions(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, opts)
+	assert.Equal(t, 0, requests)
+}
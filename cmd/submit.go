@@ -0,0 +1,55 @@
+/*
+Copyright 2020 noris network AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var submitCmd = &cobra.Command{
+	Use:   "submit",
+	Short: "Generate the ingestion spec and submit it to the Druid Overlord as a supervisor",
+	Run:   submit,
+}
+
+func init() {
+	addOverlordFlags(submitCmd)
+	rootCmd.AddCommand(submitCmd)
+}
+
+func submit(cmd *cobra.Command, args []string) {
+	spec, err := buildSpec(cmd)
+	if err != nil {
+		fmt.Printf("Error building ingestion spec: %v\n", err)
+		os.Exit(1)
+	}
+	client, err := overlordClient()
+	if err != nil {
+		fmt.Printf("Error creating Overlord client: %v\n", err)
+		os.Exit(1)
+	}
+	id, err := client.SubmitSupervisor(context.Background(), spec)
+	if err != nil {
+		fmt.Printf("Error submitting supervisor: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Submitted supervisor %q\n", id)
+}
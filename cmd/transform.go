@@ -0,0 +1,67 @@
+/*
+Copyright 2020 noris network AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	ingestion "github.com/noris-network/prometheus-druid-ingestion"
+)
+
+var (
+	transforms      = []string{}
+	transformFilter = ""
+	filterByQuery   = false
+)
+
+func init() {
+	f := rootCmd.PersistentFlags()
+	f.StringArrayVar(&transforms, "transform", transforms, "Add a dimension given as name=expression, e.g. \"namespace=regexp_extract(pod, '^([^-]+)', 1)\" (repeatable)")
+	f.BoolVar(&filterByQuery, "filter-by-query", filterByQuery, "Only ingest the series selected by the label matchers of --query")
+	f.StringVar(&transformFilter, "transform-filter", transformFilter, "Only ingest rows matching this Druid expression, e.g. \"name != 'up'\"")
+}
+
+// transformOptions returns the options for the transform flags.
+func transformOptions() ([]ingestion.KafkaIngestionSpecOptions, error) {
+	var opts []ingestion.KafkaIngestionSpecOptions
+	if len(transforms) > 0 {
+		parsed := make([]ingestion.Transform, 0, len(transforms))
+		for _, s := range transforms {
+			t, err := ingestion.ParseTransform(s)
+			if err != nil {
+				return nil, err
+			}
+			parsed = append(parsed, t)
+		}
+		opts = append(opts, ingestion.AddTransformDimensions(parsed...))
+	}
+	if transformFilter != "" {
+		opts = append(opts, ingestion.SetTransformFilter(ingestion.Filter{Type: "expression", Expression: transformFilter}))
+	}
+	return opts, nil
+}
+
+// seriesFilterOptions returns the option for --filter-by-query. It has to be
+// applied after the labels are renamed.
+func seriesFilterOptions() ([]ingestion.KafkaIngestionSpecOptions, error) {
+	if !filterByQuery {
+		return nil, nil
+	}
+	selectors, err := ingestion.ParseSelectors(query)
+	if err != nil {
+		return nil, err
+	}
+	return []ingestion.KafkaIngestionSpecOptions{ingestion.FilterSeries(selectors...)}, nil
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2020 noris network AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	ingestion "github.com/noris-network/prometheus-druid-ingestion"
+	"github.com/spf13/cobra"
+)
+
+var (
+	maxRowsInMemory           = 0
+	maxBytesInMemory          = int64(0)
+	maxRowsPerSegment         = 0
+	maxTotalRows              = int64(0)
+	intermediatePersistPeriod = ""
+	maxPendingPersists        = 0
+	indexBitmapType           = ""
+	indexDimensionCompression = ""
+	indexMetricCompression    = ""
+	indexLongEncoding         = ""
+	reportParseExceptions     = false
+	handoffConditionTimeout   = int64(0)
+	resetOffsetAutomatically  = false
+	workerThreads             = 0
+	chatThreads               = 0
+	chatRetries               = 0
+	httpTimeout               = ""
+	shutdownTimeout           = ""
+	offsetFetchPeriod         = ""
+	intermediateHandoffPeriod = ""
+	logParseExceptions        = false
+	maxParseExceptions        = 0
+	maxSavedParseExceptions   = 0
+)
+
+func init() {
+	f := rootCmd.PersistentFlags()
+	f.IntVar(&maxRowsInMemory, "max-rows-in-memory", maxRowsInMemory, "The number of rows to aggregate before persisting")
+	f.Int64Var(&maxBytesInMemory, "max-bytes-in-memory", maxBytesInMemory, "The number of bytes to aggregate in heap memory before persisting")
+	f.IntVar(&maxRowsPerSegment, "max-rows-per-segment", maxRowsPerSegment, "The number of rows to aggregate into a segment")
+	f.Int64Var(&maxTotalRows, "max-total-rows", maxTotalRows, "The number of rows to aggregate across all segments before handing off")
+	f.StringVar(&intermediatePersistPeriod, "intermediate-persist-period", intermediatePersistPeriod, "The period that determines the rate at which intermediate persists occur")
+	f.IntVar(&maxPendingPersists, "max-pending-persists", maxPendingPersists, "The maximum number of persists that can be pending but not started")
+	f.StringVar(&indexBitmapType, "index-bitmap-type", indexBitmapType, "The bitmap index type, either 'roaring' or 'concise'")
+	f.StringVar(&indexDimensionCompression, "index-dimension-compression", indexDimensionCompression, "The compression format for dimension columns")
+	f.StringVar(&indexMetricCompression, "index-metric-compression", indexMetricCompression, "The compression format for metric columns")
+	f.StringVar(&indexLongEncoding, "index-long-encoding", indexLongEncoding, "The encoding format for metric and dimension columns with type long")
+	f.BoolVar(&reportParseExceptions, "report-parse-exceptions", reportParseExceptions, "Stop ingestion on parse exceptions")
+	f.Int64Var(&handoffConditionTimeout, "handoff-condition-timeout", handoffConditionTimeout, "Milliseconds to wait for segment handoff")
+	f.BoolVar(&resetOffsetAutomatically, "reset-offset-automatically", resetOffsetAutomatically, "Reset the consumer offset if the next offset to fetch is not available")
+	f.IntVar(&workerThreads, "worker-threads", workerThreads, "The number of threads used by the supervisor for asynchronous operations")
+	f.IntVar(&chatThreads, "chat-threads", chatThreads, "The number of threads used for communicating with indexing tasks")
+	f.IntVar(&chatRetries, "chat-retries", chatRetries, "The number of times HTTP requests to indexing tasks are retried")
+	f.StringVar(&httpTimeout, "http-timeout", httpTimeout, "The period to wait for a HTTP response from an indexing task")
+	f.StringVar(&shutdownTimeout, "shutdown-timeout", shutdownTimeout, "The period to wait for the supervisor to gracefully shut down tasks")
+	f.StringVar(&offsetFetchPeriod, "offset-fetch-period", offsetFetchPeriod, "How often the supervisor queries Kafka and the indexing tasks for offsets")
+	f.StringVar(&intermediateHandoffPeriod, "intermediate-handoff-period", intermediateHandoffPeriod, "How often the tasks hand off segments")
+	f.BoolVar(&logParseExceptions, "log-parse-exceptions", logParseExceptions, "Log an error message when a parse exception occurs")
+	f.IntVar(&maxParseExceptions, "max-parse-exceptions", maxParseExceptions, "The maximum number of parse exceptions before the task halts ingestion")
+	f.IntVar(&maxSavedParseExceptions, "max-saved-parse-exceptions", maxSavedParseExceptions, "The number of parse exceptions saved in the task reports")
+}
+
+// tuningConfig builds a TuningConfig from the tuning flags that were set
+// explicitly. It returns nil if none were set, leaving Druid's defaults.
+func tuningConfig(cmd *cobra.Command) *ingestion.TuningConfig {
+	f := cmd.Flags()
+	changed := false
+	setInt := func(name string, v int, dst **int) {
+		if f.Changed(name) {
+			*dst = &v
+			changed = true
+		}
+	}
+	setInt64 := func(name string, v int64, dst **int64) {
+		if f.Changed(name) {
+			*dst = &v
+			changed = true
+		}
+	}
+	setString := func(name string, v string, dst **string) {
+		if f.Changed(name) {
+			*dst = &v
+			changed = true
+		}
+	}
+	setBool := func(name string, v bool, dst **bool) {
+		if f.Changed(name) {
+			*dst = &v
+			changed = true
+		}
+	}
+
+	tc := &ingestion.TuningConfig{Type: "kafka"}
+	setInt("max-rows-in-memory", maxRowsInMemory, &tc.MaxRowsInMemory)
+	setInt64("max-bytes-in-memory", maxBytesInMemory, &tc.MaxBytesInMemory)
+	setInt("max-rows-per-segment", maxRowsPerSegment, &tc.MaxRowsPerSegment)
+	setInt64("max-total-rows", maxTotalRows, &tc.MaxTotalRows)
+	setString("intermediate-persist-period", intermediatePersistPeriod, &tc.IntermediatePersistPeriod)
+	setInt("max-pending-persists", maxPendingPersists, &tc.MaxPendingPersists)
+	setBool("report-parse-exceptions", reportParseExceptions, &tc.ReportParseExceptions)
+	setInt64("handoff-condition-timeout", handoffConditionTimeout, &tc.HandoffConditionTimeout)
+	setBool("reset-offset-automatically", resetOffsetAutomatically, &tc.ResetOffsetAutomatically)
+	setInt("worker-threads", workerThreads, &tc.WorkerThreads)
+	setInt("chat-threads", chatThreads, &tc.ChatThreads)
+	setInt("chat-retries", chatRetries, &tc.ChatRetries)
+	setString("http-timeout", httpTimeout, &tc.HTTPTimeout)
+	setString("shutdown-timeout", shutdownTimeout, &tc.ShutdownTimeout)
+	setString("offset-fetch-period", offsetFetchPeriod, &tc.OffsetFetchPeriod)
+	setString("intermediate-handoff-period", intermediateHandoffPeriod, &tc.IntermediateHandoffPeriod)
+	setBool("log-parse-exceptions", logParseExceptions, &tc.LogParseExceptions)
+	setInt("max-parse-exceptions", maxParseExceptions, &tc.MaxParseExceptions)
+	setInt("max-saved-parse-exceptions", maxSavedParseExceptions, &tc.MaxSavedParseExceptions)
+
+	indexSpec := ingestion.IndexSpec{
+		DimensionCompression: indexDimensionCompression,
+		MetricCompression:    indexMetricCompression,
+		LongEncoding:         indexLongEncoding,
+	}
+	if indexBitmapType != "" {
+		indexSpec.Bitmap = &ingestion.Bitmap{Type: indexBitmapType}
+	}
+	if indexSpec != (ingestion.IndexSpec{}) {
+		tc.IndexSpec = &indexSpec
+		changed = true
+	}
+
+	if !changed {
+		return nil
+	}
+	return tc
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2020 noris network AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	ingestion "github.com/noris-network/prometheus-druid-ingestion"
+	"github.com/spf13/cobra"
+)
+
+var (
+	watchInterval   = 5 * time.Minute
+	watchAddOnly    = false
+	watchMinBackoff = 10 * time.Second
+	watchMaxBackoff = 10 * time.Minute
+	watchCmd        = &cobra.Command{
+		Use:   "watch",
+		Short: "Keep the supervisor in sync with the labels returned by the Prometheus query",
+		Long: `Periodically re-run the Prometheus query and resubmit the supervisor spec
+to the Druid Overlord whenever the set of labels changes.
+
+Errors talking to Prometheus or Druid are retried with an exponential backoff.`,
+		Run: watch,
+	}
+)
+
+func init() {
+	addOverlordFlags(watchCmd)
+	f := watchCmd.Flags()
+	f.StringVar(&supervisorID, "supervisor-id", supervisorID, "The id of the supervisor to keep in sync (defaults to the druid data source)")
+	f.DurationVar(&watchInterval, "interval", watchInterval, "How often to query Prometheus for label changes")
+	f.BoolVar(&watchAddOnly, "add-only", watchAddOnly, "Only add new labels as dimensions, never remove existing ones")
+	f.DurationVar(&watchMinBackoff, "min-backoff", watchMinBackoff, "The initial delay before retrying after an error")
+	f.DurationVar(&watchMaxBackoff, "max-backoff", watchMaxBackoff, "The maximum delay before retrying after an error")
+	rootCmd.AddCommand(watchCmd)
+}
+
+func watch(cmd *cobra.Command, args []string) {
+	// Catch invalid flags before entering the loop.
+	if err := checkFlags(cmd); err != nil {
+		fmt.Printf("Error building ingestion spec: %v\n", err)
+		os.Exit(1)
+	}
+	// Without discovered labels the spec never changes, so it only has to be
+	// submitted once.
+	if !discoversLabels() {
+		fmt.Println("Error: there are no label changes to watch with --labels-column or a discovery --schema-mode, use submit instead")
+		os.Exit(1)
+	}
+	client, err := overlordClient()
+	if err != nil {
+		fmt.Printf("Error creating Overlord client: %v\n", err)
+		os.Exit(1)
+	}
+	id := supervisorID
+	if id == "" {
+		id = druidDataSource
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		log.Printf("Shutting down")
+		cancel()
+	}()
+
+	var current ingestion.LabelSet
+	backoff := watchMinBackoff
+	for {
+		var wait time.Duration
+		next, err := syncSupervisor(ctx, cmd, client, id, current)
+		if err != nil {
+			log.Printf("Error syncing supervisor %q, retrying in %s: %v", id, backoff, err)
+			wait = backoff
+			backoff *= 2
+			if backoff > watchMaxBackoff {
+				backoff = watchMaxBackoff
+			}
+		} else {
+			current = next
+			wait = watchInterval
+			backoff = watchMinBackoff
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// syncSupervisor queries the labels from Prometheus and resubmits the
+// supervisor spec if they differ from current. It returns the labels of the
+// running supervisor. If current is nil, the running supervisor is looked up.
+func syncSupervisor(ctx context.Context, cmd *cobra.Command, client *ingestion.OverlordClient, id string, current ingestion.LabelSet) (ingestion.LabelSet, error) {
+	if current == nil {
+		running, err := client.GetSupervisor(ctx, id)
+		var overlordErr *ingestion.OverlordError
+		switch {
+		case errors.As(err, &overlordErr) && overlordErr.StatusCode == http.StatusNotFound:
+			log.Printf("Supervisor %q does not exist yet", id)
+		case err != nil:
+			return nil, fmt.Errorf("fetching supervisor: %w", err)
+		default:
+			current = running.Labels()
+		}
+	}
+
+	queryCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	labels, err := queryLabels(queryCtx)
+	if err != nil {
+		return nil, err
+	}
+	if watchAddOnly {
+		labels = current.Union(labels)
+	}
+	if current != nil && labels.Equal(current) {
+		return current, nil
+	}
+
+	metricOpts, err := metricTypeOptions(queryCtx)
+	if err != nil {
+		return nil, err
+	}
+	spec, err := newSpec(cmd, labels, metricOpts...)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := client.SubmitSupervisor(ctx, spec); err != nil {
+		return nil, fmt.Errorf("submitting supervisor: %w", err)
+	}
+	log.Printf("Submitted supervisor %q, labels added: %v, labels removed: %v",
+		id, labels.Difference(current), current.Difference(labels))
+	return labels, nil
+}
@@ -0,0 +1,178 @@
+/*
+Copyright 2020 noris network AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingestion
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/common/model"
+)
+
+// timeColumn is the primary timestamp column of every Druid data source.
+const timeColumn = "__time"
+
+// label returns the Prometheus label extracted by the field, if it is a label
+// field.
+func (f Field) label() (string, bool) {
+	if f.Type != "path" || !strings.HasPrefix(f.Expr, "$.labels.") {
+		return "", false
+	}
+	return strings.TrimPrefix(f.Expr, "$.labels."), true
+}
+
+// labelColumn returns the column of the label, adding a flatten field for it
+// if it has none. The label is only stored if it is a dimension. The
+// '__name__' label is stored in the 'name' column.
+func (spec *KafkaIngestionSpec) labelColumn(label string) string {
+	if label == model.MetricNameLabel {
+		return "name"
+	}
+	fs := spec.flattenSpec()
+	for _, f := range fs.Fields {
+		if l, ok := f.label(); ok && l == label {
+			return f.Name
+		}
+	}
+	fs.Fields = append(fs.Fields, Field{Type: "path", Name: label, Expr: "$.labels." + label})
+	return label
+}
+
+// reservedColumns returns the columns of the spec that labels can collide
+// with: the timestamp column, the root fields added by
+// prometheus-kafka-adapter and the names of the metrics.
+func (spec *KafkaIngestionSpec) reservedColumns() map[string]bool {
+	reserved := map[string]bool{
+		timeColumn:                  true,
+		spec.timestampSpec().Column: true,
+	}
+	for _, f := range spec.flattenSpec().Fields {
+		if _, ok := f.label(); !ok {
+			reserved[f.Name] = true
+		}
+	}
+	for _, m := range spec.DataSchema.MetricsSpec {
+		reserved[m.Name] = true
+	}
+	return reserved
+}
+
+// RenameCollidingLabels prefixes the column names of labels that collide with
+// reserved columns, e.g. a label 'name' is stored in the column 'label_name'
+// if the prefix is 'label_'. The prefix is repeated until the column name is
+// unique. It has to be applied after SetLabels. An empty prefix leaves the
+// spec unchanged.
+func RenameCollidingLabels(prefix string) KafkaIngestionSpecOptions {
+	return func(spec *KafkaIngestionSpec) {
+		if prefix == "" {
+			return
+		}
+		reserved := spec.reservedColumns()
+		fields := spec.flattenSpec().Fields
+		taken := make(map[string]bool, len(fields))
+		for _, f := range fields {
+			taken[f.Name] = true
+		}
+		dimensions := spec.dimensionsSpec().Dimensions
+		for i, f := range fields {
+			if _, ok := f.label(); !ok || !reserved[f.Name] {
+				continue
+			}
+			column := prefix + f.Name
+			for reserved[column] || taken[column] {
+				column = prefix + column
+			}
+			taken[column] = true
+			fields[i].Name = column
+			// The label dimensions follow the 'name' dimension, so the last
+			// occurrence belongs to the label.
+			for j := len(dimensions) - 1; j >= 0; j-- {
+				if dimensions[j] == f.Name {
+					dimensions[j] = column
+					break
+				}
+			}
+		}
+	}
+}
+
+// ColumnCollisionError is returned if the spec uses a column name more than
+// once.
+type ColumnCollisionError struct {
+	Columns []string
+}
+
+func (e *ColumnCollisionError) Error() string {
+	return fmt.Sprintf("column names used more than once: %s", strings.Join(e.Columns, ", "))
+}
+
+// UnknownColumnError is returned if the spec refers to a column it doesn't
+// have, e.g. a metric reading a label that isn't extracted.
+type UnknownColumnError struct {
+	// Context describes what refers to the column, e.g. 'metric "job_last"'.
+	Context string
+	Column  string
+}
+
+func (e *UnknownColumnError) Error() string {
+	return fmt.Sprintf("%s: unknown column %q", e.Context, e.Column)
+}
+
+// validateColumns checks that the flatten fields, dimensions and metrics of
+// the spec don't collide with each other or the timestamp column. This
+// happens if a Prometheus label is called like a reserved column, e.g. 'name',
+// 'value' or 'timestamp'. Such labels can be renamed with
+// RenameCollidingLabels.
+func (spec *KafkaIngestionSpec) validateColumns() error {
+	collisions := make(map[string]bool)
+	timestamp := spec.timestampSpec().Column
+
+	fields := make(map[string]bool)
+	for _, f := range spec.flattenSpec().Fields {
+		if fields[f.Name] || f.Name == timestamp || f.Name == timeColumn {
+			collisions[f.Name] = true
+		}
+		fields[f.Name] = true
+	}
+
+	metrics := make(map[string]bool)
+	for _, m := range spec.DataSchema.MetricsSpec {
+		if metrics[m.Name] {
+			collisions[m.Name] = true
+		}
+		metrics[m.Name] = true
+	}
+
+	dimensions := make(map[string]bool)
+	for _, d := range spec.dimensionsSpec().Dimensions {
+		if dimensions[d] || metrics[d] || d == timestamp || d == timeColumn {
+			collisions[d] = true
+		}
+		dimensions[d] = true
+	}
+
+	if len(collisions) == 0 {
+		return nil
+	}
+	columns := make([]string, 0, len(collisions))
+	for c := range collisions {
+		columns = append(columns, c)
+	}
+	sort.Strings(columns)
+	return &ColumnCollisionError{Columns: columns}
+}
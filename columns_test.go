@@ -0,0 +1,94 @@
+/*
+Copyright 2020 noris network AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingestion
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKafkaIngestionSpec_Validate(t *testing.T) {
+	var testData = []struct {
+		name     string
+		options  []KafkaIngestionSpecOptions
+		expected []string
+	}{
+		{
+			name: "no collisions",
+			options: []KafkaIngestionSpecOptions{
+				SetLabels(LabelSet{"job", "instance"}),
+			},
+		},
+		{
+			name: "reserved labels",
+			options: []KafkaIngestionSpecOptions{
+				SetLabels(LabelSet{"name", "value", "timestamp", "job"}),
+			},
+			expected: []string{"name", "timestamp", "value"},
+		},
+		{
+			name: "metric name",
+			options: []KafkaIngestionSpecOptions{
+				SetLabels(LabelSet{"count"}),
+				SetSpecMode(SpecModeModern),
+			},
+			expected: []string{"count"},
+		},
+		{
+			name: "renamed labels",
+			options: []KafkaIngestionSpecOptions{
+				SetLabels(LabelSet{"name", "value", "timestamp", "job"}),
+				RenameCollidingLabels("label_"),
+			},
+		},
+	}
+
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			err := NewKafkaIngestionSpec(test.options...).Validate()
+			if test.expected == nil {
+				assert.NoError(t, err)
+				return
+			}
+			var collision *ColumnCollisionError
+			assert.True(t, errors.As(err, &collision))
+			assert.Equal(t, test.expected, collision.Columns)
+		})
+	}
+}
+
+func TestRenameCollidingLabels(t *testing.T) {
+	spec := NewKafkaIngestionSpec(
+		SetLabels(LabelSet{"name", "job", "label_value", "value"}),
+		RenameCollidingLabels("label_"),
+	)
+	assert.Equal(t, FieldList{
+		{Type: "path", Name: "label_name", Expr: "$.labels.name"},
+		{Type: "path", Name: "job", Expr: "$.labels.job"},
+		{Type: "path", Name: "label_value", Expr: "$.labels.label_value"},
+		{Type: "path", Name: "label_label_value", Expr: "$.labels.value"},
+		{Type: "root", Name: "name", Expr: "name"},
+		{Type: "root", Name: "value", Expr: "value"},
+	}, spec.flattenSpec().Fields)
+	assert.Equal(t, LabelSet{"name", "label_name", "job", "label_value", "label_label_value"}, spec.dimensionsSpec().Dimensions)
+	assert.Equal(t, LabelSet{"name", "job", "label_value", "value"}, spec.Labels())
+
+	unchanged := NewKafkaIngestionSpec(SetLabels(LabelSet{"name"}), RenameCollidingLabels(""))
+	assert.Equal(t, NewKafkaIngestionSpec(SetLabels(LabelSet{"name"})), unchanged)
+}
@@ -0,0 +1,556 @@
+/*
+Copyright 2020 noris network AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingestion
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SpecDiff describes the changes between a current and a desired
+// KafkaIngestionSpec.
+type SpecDiff struct {
+	DimensionsAdded   []string
+	DimensionsRemoved []string
+	FieldsAdded       FieldList
+	FieldsRemoved     FieldList
+	FieldsChanged     []FieldChange
+	MetricsAdded      []Metric
+	MetricsRemoved    []Metric
+	MetricsChanged    []MetricChange
+	DataSchemaChanges []ValueChange
+	IOConfigChanges   []ValueChange
+}
+
+// FieldChange is a flatten field whose definition changed.
+type FieldChange struct {
+	Name    string
+	Current Field
+	Desired Field
+}
+
+// MetricChange is a metric whose aggregator changed.
+type MetricChange struct {
+	Name    string
+	Current Metric
+	Desired Metric
+}
+
+// ValueChange is a changed value at a path, e.g. 'consumerProperties.
+// bootstrap.servers'. A nil value means that the path is not set.
+type ValueChange struct {
+	Path    string
+	Current interface{}
+	Desired interface{}
+}
+
+// Empty reports whether there are no changes.
+func (d SpecDiff) Empty() bool {
+	return len(d.DimensionsAdded) == 0 &&
+		len(d.DimensionsRemoved) == 0 &&
+		len(d.FieldsAdded) == 0 &&
+		len(d.FieldsRemoved) == 0 &&
+		len(d.FieldsChanged) == 0 &&
+		len(d.MetricsAdded) == 0 &&
+		len(d.MetricsRemoved) == 0 &&
+		len(d.MetricsChanged) == 0 &&
+		len(d.DataSchemaChanges) == 0 &&
+		len(d.IOConfigChanges) == 0
+}
+
+// String renders the changes in a human readable format.
+func (d SpecDiff) String() string {
+	var b strings.Builder
+	section := func(title string, lines []string) {
+		if len(lines) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "%s:\n", title)
+		for _, l := range lines {
+			fmt.Fprintf(&b, "  %s\n", l)
+		}
+	}
+
+	var lines []string
+	for _, dim := range d.DimensionsAdded {
+		lines = append(lines, "+ "+dim)
+	}
+	section("Dimensions added", lines)
+
+	lines = nil
+	for _, dim := range d.DimensionsRemoved {
+		lines = append(lines, "- "+dim)
+	}
+	section("Dimensions removed", lines)
+
+	lines = nil
+	for _, f := range d.FieldsAdded {
+		lines = append(lines, fmt.Sprintf("+ %s (%s %s)", f.Name, f.Type, f.Expr))
+	}
+	section("Flatten fields added", lines)
+
+	lines = nil
+	for _, f := range d.FieldsRemoved {
+		lines = append(lines, fmt.Sprintf("- %s (%s %s)", f.Name, f.Type, f.Expr))
+	}
+	section("Flatten fields removed", lines)
+
+	lines = nil
+	for _, c := range d.FieldsChanged {
+		lines = append(lines, fmt.Sprintf("~ %s: (%s %s) -> (%s %s)",
+			c.Name, c.Current.Type, c.Current.Expr, c.Desired.Type, c.Desired.Expr))
+	}
+	section("Flatten fields changed", lines)
+
+	lines = nil
+	for _, m := range d.MetricsAdded {
+		lines = append(lines, "+ "+formatValue(m))
+	}
+	section("Metrics added", lines)
+
+	lines = nil
+	for _, m := range d.MetricsRemoved {
+		lines = append(lines, "- "+formatValue(m))
+	}
+	section("Metrics removed", lines)
+
+	lines = nil
+	for _, c := range d.MetricsChanged {
+		lines = append(lines, fmt.Sprintf("~ %s: %s -> %s", c.Name, formatValue(c.Current), formatValue(c.Desired)))
+	}
+	section("Metrics changed", lines)
+
+	lines = nil
+	for _, c := range d.DataSchemaChanges {
+		lines = append(lines, fmt.Sprintf("~ %s: %s -> %s", c.Path, formatValue(c.Current), formatValue(c.Desired)))
+	}
+	section("dataSchema changes", lines)
+
+	lines = nil
+	for _, c := range d.IOConfigChanges {
+		lines = append(lines, fmt.Sprintf("~ %s: %s -> %s", c.Path, formatValue(c.Current), formatValue(c.Desired)))
+	}
+	section("ioConfig changes", lines)
+
+	return b.String()
+}
+
+func formatValue(v interface{}) string {
+	if v == nil {
+		return "<unset>"
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(b)
+}
+
+// DiffSpecs compares the dimensions, flatten fields, metrics, granularitySpec,
+// transformSpec and ioConfig of the current and the desired spec. The specs
+// don't need to use the same SpecMode.
+func DiffSpecs(current, desired *KafkaIngestionSpec) (SpecDiff, error) {
+	var d SpecDiff
+
+	currentDims, desiredDims := specDimensions(current), specDimensions(desired)
+	d.DimensionsAdded = missingFrom(desiredDims, currentDims)
+	d.DimensionsRemoved = missingFrom(currentDims, desiredDims)
+
+	currentFields := make(map[string]Field)
+	for _, f := range specFields(current) {
+		currentFields[f.Name] = f
+	}
+	desiredFields := make(map[string]Field)
+	for _, f := range specFields(desired) {
+		desiredFields[f.Name] = f
+		c, ok := currentFields[f.Name]
+		switch {
+		case !ok:
+			d.FieldsAdded = append(d.FieldsAdded, f)
+		case c != f:
+			d.FieldsChanged = append(d.FieldsChanged, FieldChange{
+				Name:    f.Name,
+				Current: c,
+				Desired: f,
+			})
+		}
+	}
+	for _, f := range specFields(current) {
+		if _, ok := desiredFields[f.Name]; !ok {
+			d.FieldsRemoved = append(d.FieldsRemoved, f)
+		}
+	}
+
+	currentMetrics := make(map[string]Metric)
+	for _, m := range current.DataSchema.MetricsSpec {
+		currentMetrics[m.Name] = m
+	}
+	desiredMetrics := make(map[string]Metric)
+	for _, m := range desired.DataSchema.MetricsSpec {
+		desiredMetrics[m.Name] = m
+		c, ok := currentMetrics[m.Name]
+		switch {
+		case !ok:
+			d.MetricsAdded = append(d.MetricsAdded, m)
+		case !reflect.DeepEqual(c, m):
+			d.MetricsChanged = append(d.MetricsChanged, MetricChange{
+				Name:    m.Name,
+				Current: c,
+				Desired: m,
+			})
+		}
+	}
+	for _, m := range current.DataSchema.MetricsSpec {
+		if _, ok := desiredMetrics[m.Name]; !ok {
+			d.MetricsRemoved = append(d.MetricsRemoved, m)
+		}
+	}
+
+	currentSchema, err := toMap(schemaSettings(current))
+	if err != nil {
+		return d, err
+	}
+	desiredSchema, err := toMap(schemaSettings(desired))
+	if err != nil {
+		return d, err
+	}
+	// Druid fills in the defaults of the granularitySpec.
+	applyDefaults(currentSchema, dataSchemaDefaults)
+	applyDefaults(desiredSchema, dataSchemaDefaults)
+	d.DataSchemaChanges = diffValues("", currentSchema, desiredSchema)
+	d.DataSchemaChanges = append(d.DataSchemaChanges, diffDimensionSchemas(current, desired)...)
+
+	currentIO, err := toMap(current.IOConfig)
+	if err != nil {
+		return d, err
+	}
+	desiredIO, err := toMap(desired.IOConfig)
+	if err != nil {
+		return d, err
+	}
+	// The flattenSpec of the inputFormat is already covered by the fields.
+	for _, m := range []map[string]interface{}{currentIO, desiredIO} {
+		if f, ok := m["inputFormat"].(map[string]interface{}); ok {
+			delete(f, "flattenSpec")
+		}
+	}
+	// Druid fills in the defaults of the ioConfig and returns its periods in
+	// seconds, so both are added to the specs and the periods are normalized.
+	for _, m := range []map[string]interface{}{currentIO, desiredIO} {
+		applyDefaults(m, ioConfigDefaults)
+		for _, k := range ioConfigPeriods {
+			if p, ok := m[k].(string); ok {
+				m[k] = normalizePeriod(p)
+			}
+		}
+	}
+	d.IOConfigChanges = diffValues("", currentIO, desiredIO)
+
+	return d, nil
+}
+
+// specDimensions returns the dimensions of a spec, regardless of its mode.
+func specDimensions(spec *KafkaIngestionSpec) LabelSet {
+	if ds := specDimensionsSpec(spec); ds != nil {
+		return ds.Dimensions
+	}
+	return nil
+}
+
+// diffDimensionSchemas compares the schemas of the dimensions present in both
+// specs. Plain string dimensions have no schema.
+func diffDimensionSchemas(current, desired *KafkaIngestionSpec) []ValueChange {
+	var changes []ValueChange
+	currentSchemas, desiredSchemas := specDimensionSchemas(current), specDimensionSchemas(desired)
+	for _, name := range specDimensions(desired) {
+		if !specDimensions(current).Contains(name) {
+			continue
+		}
+		c, cok := currentSchemas[name]
+		d, dok := desiredSchemas[name]
+		if cok == dok && reflect.DeepEqual(c, d) {
+			continue
+		}
+		change := ValueChange{Path: "dimensionsSpec.dimensions." + name}
+		if cok {
+			change.Current = c
+		}
+		if dok {
+			change.Desired = d
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// specDimensionSchemas returns the dimension schemas of a spec, regardless of
+// its mode.
+func specDimensionSchemas(spec *KafkaIngestionSpec) map[string]DimensionSchema {
+	if ds := specDimensionsSpec(spec); ds != nil {
+		return ds.Schemas
+	}
+	return nil
+}
+
+// specDimensionsSpec returns the DimensionsSpec of a spec, regardless of its
+// mode. Unlike dimensionsSpec it doesn't create a missing one.
+func specDimensionsSpec(spec *KafkaIngestionSpec) *DimensionsSpec {
+	if spec.DataSchema.Parser != nil {
+		return &spec.DataSchema.Parser.ParseSpec.DimensionsSpec
+	}
+	return spec.DataSchema.DimensionsSpec
+}
+
+// specFlattenSpec returns the FlattenSpec of a spec, regardless of its mode.
+// Unlike flattenSpec it doesn't create a missing one.
+func specFlattenSpec(spec *KafkaIngestionSpec) *FlattenSpec {
+	if spec.DataSchema.Parser != nil {
+		return &spec.DataSchema.Parser.ParseSpec.FlattenSpec
+	}
+	if spec.IOConfig.InputFormat != nil {
+		return &spec.IOConfig.InputFormat.FlattenSpec
+	}
+	return nil
+}
+
+// specFields returns the flatten fields of a spec, regardless of its mode.
+func specFields(spec *KafkaIngestionSpec) FieldList {
+	if fs := specFlattenSpec(spec); fs != nil {
+		return fs.Fields
+	}
+	return nil
+}
+
+// missingFrom returns the elements of a that are not in b.
+func missingFrom(a, b []string) []string {
+	seen := make(map[string]bool, len(b))
+	for _, s := range b {
+		seen[s] = true
+	}
+	var out []string
+	for _, s := range a {
+		if !seen[s] {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// schemaSettings returns the parts of the dataSchema that are not covered by
+// the dimensions, fields and metrics. An empty transformSpec, as returned by
+// Druid, is left out.
+func schemaSettings(spec *KafkaIngestionSpec) interface{} {
+	ts := spec.DataSchema.TransformSpec
+	if ts != nil && len(ts.Transforms) == 0 && ts.Filter == nil {
+		ts = nil
+	}
+	type dimensionsSettings struct {
+		DimensionExclusions []string `json:"dimensionExclusions,omitempty"`
+		UseSchemaDiscovery  bool     `json:"useSchemaDiscovery"`
+	}
+	type flattenSettings struct {
+		UseFieldDiscovery bool `json:"useFieldDiscovery"`
+	}
+	var dimensions dimensionsSettings
+	if ds := specDimensionsSpec(spec); ds != nil {
+		dimensions = dimensionsSettings{dimensionExclusions(spec, ds), ds.UseSchemaDiscovery}
+	}
+	// Druid discovers fields unless it is disabled.
+	flatten := flattenSettings{true}
+	if fs := specFlattenSpec(spec); fs != nil && fs.UseFieldDiscovery != nil {
+		flatten.UseFieldDiscovery = *fs.UseFieldDiscovery
+	}
+	return struct {
+		GranularitySpec GranularitySpec    `json:"granularitySpec"`
+		TransformSpec   *TransformSpec     `json:"transformSpec,omitempty"`
+		DimensionsSpec  dimensionsSettings `json:"dimensionsSpec"`
+		FlattenSpec     flattenSettings    `json:"flattenSpec"`
+	}{spec.DataSchema.GranularitySpec, ts, dimensions, flatten}
+}
+
+// dimensionExclusions returns the sorted dimension exclusions of the spec
+// without the ones Druid adds on its own: the time and timestamp columns and
+// the names and input fields of the metrics.
+func dimensionExclusions(spec *KafkaIngestionSpec, ds *DimensionsSpec) []string {
+	implicit := map[string]bool{timeColumn: true}
+	if spec.DataSchema.Parser != nil {
+		implicit[spec.DataSchema.Parser.ParseSpec.TimeStampSpec.Column] = true
+	}
+	if ts := spec.DataSchema.TimestampSpec; ts != nil {
+		implicit[ts.Column] = true
+	}
+	var add func(m Metric)
+	add = func(m Metric) {
+		implicit[m.Name] = true
+		if m.FieldName != "" {
+			implicit[m.FieldName] = true
+		}
+		if m.Aggregator != nil {
+			add(*m.Aggregator)
+		}
+	}
+	for _, m := range spec.DataSchema.MetricsSpec {
+		add(m)
+	}
+	var exclusions []string
+	for _, e := range ds.DimensionExclusions {
+		if !implicit[e] {
+			exclusions = append(exclusions, e)
+		}
+	}
+	sort.Strings(exclusions)
+	return exclusions
+}
+
+// dataSchemaDefaults are the values Druid fills in for unset settings of the
+// dataSchema, by their path in schemaSettings.
+var dataSchemaDefaults = map[string]interface{}{
+	"granularitySpec.rollup": true,
+}
+
+// ioConfigDefaults are the values Druid fills in for unset settings of the
+// ioConfig. The defaults of the autoScalerConfig only apply if it is set.
+var ioConfigDefaults = map[string]interface{}{
+	"replicas":          1.0,
+	"taskCount":         1.0,
+	"startDelay":        "PT5S",
+	"period":            "PT30S",
+	"completionTimeout": "PT30M",
+	"pollTimeout":       100.0,
+	"useEarliestOffset": false,
+
+	"autoScalerConfig.lagCollectionIntervalMillis":          30000.0,
+	"autoScalerConfig.lagCollectionRangeMillis":             600000.0,
+	"autoScalerConfig.scaleOutThreshold":                    float64(defaultScaleOutThreshold),
+	"autoScalerConfig.triggerScaleOutFractionThreshold":     0.3,
+	"autoScalerConfig.scaleInThreshold":                     float64(defaultScaleInThreshold),
+	"autoScalerConfig.triggerScaleInFractionThreshold":      0.9,
+	"autoScalerConfig.scaleActionStartDelayMillis":          300000.0,
+	"autoScalerConfig.scaleActionPeriodMillis":              60000.0,
+	"autoScalerConfig.scaleInStep":                          1.0,
+	"autoScalerConfig.scaleOutStep":                         2.0,
+	"autoScalerConfig.minTriggerScaleActionFrequencyMillis": 600000.0,
+}
+
+// applyDefaults sets the values of the unset paths of defaults in the generic
+// JSON object m. Paths below objects missing in m are skipped, so settings
+// removed from a spec are only reported if they differ from the defaults.
+func applyDefaults(m map[string]interface{}, defaults map[string]interface{}) {
+	for path, value := range defaults {
+		keys := strings.Split(path, ".")
+		parent := m
+		for _, k := range keys[:len(keys)-1] {
+			parent, _ = parent[k].(map[string]interface{})
+		}
+		if parent == nil {
+			continue
+		}
+		if _, ok := parent[keys[len(keys)-1]]; !ok {
+			parent[keys[len(keys)-1]] = value
+		}
+	}
+}
+
+// ioConfigPeriods are the keys of the ISO-8601 periods of the ioConfig.
+var ioConfigPeriods = []string{
+	"taskDuration",
+	"startDelay",
+	"period",
+	"completionTimeout",
+	"lateMessageRejectionPeriod",
+	"earlyMessageRejectionPeriod",
+}
+
+// normalizePeriod converts an ISO-8601 period to seconds, like Druid does for
+// the periods of the ioConfig, e.g. 'PT10M' to 'PT600S'. Days and weeks are
+// converted as 24 hours and 7 days. Periods with years or months and invalid
+// periods are returned unchanged.
+func normalizePeriod(p string) string {
+	m := periodPattern.FindStringSubmatch(p)
+	if ValidatePeriod(p) != nil || m[1] != "" || m[2] != "" {
+		return p
+	}
+	// the submatches of the weeks, days, hours, minutes and seconds
+	units := map[int]time.Duration{3: 7 * 24 * time.Hour, 4: 24 * time.Hour, 6: time.Hour, 7: time.Minute, 8: time.Second}
+	var d time.Duration
+	for i, unit := range units {
+		if m[i] == "" {
+			continue
+		}
+		n, _ := strconv.ParseFloat(m[i][:len(m[i])-1], 64)
+		d += time.Duration(n * float64(unit))
+	}
+	return "PT" + strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "S"
+}
+
+// toMap converts v to its generic JSON representation.
+func toMap(v interface{}) (map[string]interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// diffValues recursively compares two generic JSON objects and returns the
+// changed leaf values sorted by path.
+func diffValues(prefix string, current, desired map[string]interface{}) []ValueChange {
+	keys := make(map[string]bool)
+	for k := range current {
+		keys[k] = true
+	}
+	for k := range desired {
+		keys[k] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	var changes []ValueChange
+	for _, k := range sorted {
+		path := k
+		if prefix != "" {
+			path = prefix + "." + k
+		}
+		c, d := current[k], desired[k]
+		cm, cok := c.(map[string]interface{})
+		dm, dok := d.(map[string]interface{})
+		if cok && dok {
+			changes = append(changes, diffValues(path, cm, dm)...)
+			continue
+		}
+		if !reflect.DeepEqual(c, d) {
+			changes = append(changes, ValueChange{
+				Path:    path,
+				Current: c,
+				Desired: d,
+			})
+		}
+	}
+	return changes
+}
@@ -0,0 +1,437 @@
+/*
+Copyright 2020 noris network AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingestion
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffSpecs(t *testing.T) {
+	var testData = []struct {
+		name     string
+		current  *KafkaIngestionSpec
+		desired  *KafkaIngestionSpec
+		expected SpecDiff
+	}{
+		{
+			name:     "identical specs",
+			current:  NewKafkaIngestionSpec(SetLabels(LabelSet{"foo"})),
+			desired:  NewKafkaIngestionSpec(SetLabels(LabelSet{"foo"})),
+			expected: SpecDiff{},
+		},
+		{
+			name:    "different spec modes",
+			current: NewKafkaIngestionSpec(SetLabels(LabelSet{"foo"})),
+			desired: NewKafkaIngestionSpec(SetLabels(LabelSet{"foo"}), SetSpecMode(SpecModeModern)),
+			expected: SpecDiff{
+				IOConfigChanges: []ValueChange{
+					{
+						Path:    "inputFormat",
+						Current: nil,
+						Desired: map[string]interface{}{"type": "json"},
+					},
+				},
+			},
+		},
+		{
+			name:    "labels changed",
+			current: NewKafkaIngestionSpec(SetLabels(LabelSet{"foo", "bar"})),
+			desired: NewKafkaIngestionSpec(SetLabels(LabelSet{"foo", "baz"})),
+			expected: SpecDiff{
+				DimensionsAdded:   []string{"baz"},
+				DimensionsRemoved: []string{"bar"},
+				FieldsAdded: FieldList{
+					{Type: "path", Name: "baz", Expr: "$.labels.baz"},
+				},
+				FieldsRemoved: FieldList{
+					{Type: "path", Name: "bar", Expr: "$.labels.bar"},
+				},
+			},
+		},
+		{
+			name: "field changed",
+			current: func() *KafkaIngestionSpec {
+				spec := NewKafkaIngestionSpec(SetLabels(LabelSet{"foo"}))
+				spec.DataSchema.Parser.ParseSpec.FlattenSpec.Fields[0].Expr = "$.foo"
+				return spec
+			}(),
+			desired: NewKafkaIngestionSpec(SetLabels(LabelSet{"foo"})),
+			expected: SpecDiff{
+				FieldsChanged: []FieldChange{
+					{
+						Name:    "foo",
+						Current: Field{Type: "path", Name: "foo", Expr: "$.foo"},
+						Desired: Field{Type: "path", Name: "foo", Expr: "$.labels.foo"},
+					},
+				},
+			},
+		},
+		{
+			name:    "ioConfig changed",
+			current: NewKafkaIngestionSpec(),
+			desired: NewKafkaIngestionSpec(SetTopic("test"), SetBrokers("test")),
+			expected: SpecDiff{
+				IOConfigChanges: []ValueChange{
+					{
+						Path:    "consumerProperties.bootstrap.servers",
+						Current: "kafka01:9090,kafka02:9090,kafka03:9090",
+						Desired: "test",
+					},
+					{
+						Path:    "topic",
+						Current: "prometheus",
+						Desired: "test",
+					},
+				},
+			},
+		},
+		{
+			name:    "metrics changed",
+			current: NewKafkaIngestionSpec(SetMetricTypes(MetricTypes{"up": MetricTypeGauge})),
+			desired: NewKafkaIngestionSpec(SetMetricTypes(MetricTypes{"requests_total": MetricTypeCounter})),
+			expected: SpecDiff{
+				MetricsAdded: []Metric{
+					filteredMetric([]string{"requests_total"}, Metric{Name: "counter_max", Type: "doubleMax", FieldName: "value"}),
+					filteredMetric([]string{"requests_total"}, Metric{Name: "counter_last", Type: "doubleLast", FieldName: "value"}),
+				},
+				MetricsRemoved: []Metric{
+					filteredMetric([]string{"up"}, Metric{Name: "gauge_min", Type: "doubleMin", FieldName: "value"}),
+					filteredMetric([]string{"up"}, Metric{Name: "gauge_max", Type: "doubleMax", FieldName: "value"}),
+					filteredMetric([]string{"up"}, Metric{Name: "gauge_sum", Type: "doubleSum", FieldName: "value"}),
+					filteredMetric([]string{"up"}, Metric{Name: "gauge_count", Type: "count"}),
+				},
+			},
+		},
+		{
+			name:    "metric changed",
+			current: NewKafkaIngestionSpec(SetMetricTypes(MetricTypes{"a": MetricTypeCounter})),
+			desired: NewKafkaIngestionSpec(SetMetricTypes(MetricTypes{"a": MetricTypeCounter, "b": MetricTypeCounter})),
+			expected: SpecDiff{
+				MetricsChanged: []MetricChange{
+					{
+						Name:    "counter_max",
+						Current: filteredMetric([]string{"a"}, Metric{Name: "counter_max", Type: "doubleMax", FieldName: "value"}),
+						Desired: filteredMetric([]string{"a", "b"}, Metric{Name: "counter_max", Type: "doubleMax", FieldName: "value"}),
+					},
+					{
+						Name:    "counter_last",
+						Current: filteredMetric([]string{"a"}, Metric{Name: "counter_last", Type: "doubleLast", FieldName: "value"}),
+						Desired: filteredMetric([]string{"a", "b"}, Metric{Name: "counter_last", Type: "doubleLast", FieldName: "value"}),
+					},
+				},
+			},
+		},
+		{
+			name:    "extra consumer property changed",
+			current: NewKafkaIngestionSpec(SetConsumerProperty("isolation.level", "read_uncommitted")),
+			desired: NewKafkaIngestionSpec(SetConsumerProperty("isolation.level", "read_committed")),
+			expected: SpecDiff{
+				IOConfigChanges: []ValueChange{
+					{
+						Path:    "consumerProperties.isolation.level",
+						Current: "read_uncommitted",
+						Desired: "read_committed",
+					},
+				},
+			},
+		},
+		{
+			name:    "granularity and transforms changed",
+			current: NewKafkaIngestionSpec(AddTransforms(Transform{Type: "expression", Name: "ns", Expression: "pod"})),
+			desired: NewKafkaIngestionSpec(
+				SetQueryGranularity(Granularity{Simple: "NONE"}),
+				AddTransforms(Transform{Type: "expression", Name: "ns", Expression: "lower(pod)"}),
+			),
+			expected: SpecDiff{
+				DataSchemaChanges: []ValueChange{
+					{Path: "granularitySpec.queryGranularity", Current: "MINUTE", Desired: "NONE"},
+					{
+						Path:    "transformSpec.transforms",
+						Current: []interface{}{map[string]interface{}{"type": "expression", "name": "ns", "expression": "pod"}},
+						Desired: []interface{}{map[string]interface{}{"type": "expression", "name": "ns", "expression": "lower(pod)"}},
+					},
+				},
+			},
+		},
+		{
+			name:    "dimension schema changed",
+			current: NewKafkaIngestionSpec(SetLabels(LabelSet{"le", "pod"}), DisableBitmapIndex("pod")),
+			desired: NewKafkaIngestionSpec(SetLabels(LabelSet{"le", "pod"}), SetDimensionType("le", "double")),
+			expected: SpecDiff{
+				DataSchemaChanges: []ValueChange{
+					{Path: "dimensionsSpec.dimensions.le", Current: nil, Desired: DimensionSchema{Type: "double", Name: "le"}},
+					{
+						Path:    "dimensionsSpec.dimensions.pod",
+						Current: DimensionSchema{Type: "string", Name: "pod", CreateBitmapIndex: boolPointer(false)},
+						Desired: nil,
+					},
+				},
+			},
+		},
+		{
+			name:    "discovery settings changed",
+			current: NewKafkaIngestionSpec(SetSchemaMode(SchemaModeDiscovery)),
+			desired: NewKafkaIngestionSpec(SetSchemaMode(SchemaModeSchemaDiscovery, "tmp")),
+			expected: SpecDiff{
+				DataSchemaChanges: []ValueChange{
+					{
+						Path:    "dimensionsSpec.dimensionExclusions",
+						Current: []interface{}{"labels"},
+						Desired: []interface{}{"tmp"},
+					},
+					{Path: "dimensionsSpec.useSchemaDiscovery", Current: false, Desired: true},
+				},
+			},
+		},
+		{
+			name:    "field discovery disabled",
+			current: NewKafkaIngestionSpec(),
+			desired: func() *KafkaIngestionSpec {
+				spec := NewKafkaIngestionSpec()
+				spec.flattenSpec().UseFieldDiscovery = boolPointer(false)
+				return spec
+			}(),
+			expected: SpecDiff{
+				DataSchemaChanges: []ValueChange{
+					{Path: "flattenSpec.useFieldDiscovery", Current: true, Desired: false},
+				},
+			},
+		},
+		{
+			name:     "druid defaults",
+			current:  NewKafkaIngestionSpec(SetRollup(true), AddTransforms()),
+			desired:  NewKafkaIngestionSpec(),
+			expected: SpecDiff{},
+		},
+	}
+
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := DiffSpecs(test.current, test.desired)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, actual)
+			assert.Equal(t, test.expected.Empty(), actual.Empty())
+		})
+	}
+}
+
+// druidSupervisor is the response of Druid's Overlord to GET
+// /druid/indexer/v1/supervisor/prometheus for the spec of
+// TestDiffSpecs_DruidDefaults. Druid adds its defaults and returns the
+// periods in seconds.
+const druidSupervisor = `{
+  "type": "kafka",
+  "spec": {
+    "dataSchema": {
+      "dataSource": "prometheus",
+      "timestampSpec": null,
+      "dimensionsSpec": null,
+      "metricsSpec": [
+        {"type": "count", "name": "count"},
+        {"type": "doubleMax", "name": "value", "fieldName": "value", "expression": null}
+      ],
+      "granularitySpec": {
+        "type": "uniform",
+        "segmentGranularity": "HOUR",
+        "queryGranularity": "MINUTE",
+        "rollup": true,
+        "intervals": []
+      },
+      "transformSpec": {"filter": null, "transforms": []},
+      "parser": {
+        "type": "string",
+        "parseSpec": {
+          "format": "json",
+          "timestampSpec": {"column": "timestamp", "format": "iso", "missingValue": null},
+          "flattenSpec": {
+            "useFieldDiscovery": true,
+            "fields": [
+              {"type": "path", "name": "job", "expr": "$.labels.job"},
+              {"type": "root", "name": "name", "expr": "name"},
+              {"type": "root", "name": "value", "expr": "value"}
+            ]
+          },
+          "dimensionsSpec": {
+            "dimensions": [
+              {"type": "string", "name": "name", "multiValueHandling": "SORTED_ARRAY", "createBitmapIndex": true},
+              {"type": "string", "name": "job", "multiValueHandling": "SORTED_ARRAY", "createBitmapIndex": true}
+            ],
+            "dimensionExclusions": ["__time", "count", "value", "timestamp"],
+            "includeAllDimensions": false
+          }
+        }
+      }
+    },
+    "tuningConfig": {
+      "type": "kafka",
+      "maxRowsInMemory": 1000000,
+      "maxBytesInMemory": 0,
+      "maxRowsPerSegment": 5000000,
+      "intermediatePersistPeriod": "PT10M",
+      "maxPendingPersists": 0
+    },
+    "ioConfig": {
+      "topic": "prometheus",
+      "inputFormat": null,
+      "replicas": 1,
+      "taskCount": 2,
+      "taskDuration": "PT3600S",
+      "consumerProperties": {"bootstrap.servers": "kafka01:9090,kafka02:9090,kafka03:9090"},
+      "autoScalerConfig": null,
+      "pollTimeout": 100,
+      "startDelay": "PT5S",
+      "period": "PT30S",
+      "useEarliestOffset": true,
+      "completionTimeout": "PT1800S",
+      "lateMessageRejectionPeriod": null,
+      "earlyMessageRejectionPeriod": null,
+      "lateMessageRejectionStartDateTime": null,
+      "stream": "prometheus",
+      "useEarliestSequenceNumber": true,
+      "type": "kafka"
+    },
+    "context": null,
+    "suspended": false
+  },
+  "suspended": false
+}`
+
+func TestDiffSpecs_DruidDefaults(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, druidSupervisor)
+	}))
+	defer srv.Close()
+
+	current, err := NewOverlordClient(srv.URL).GetSupervisor(context.Background(), "prometheus")
+	assert.NoError(t, err)
+
+	desired := NewKafkaIngestionSpec(SetLabels(LabelSet{"job"}), SetTaskCount(2), SetTaskDuration("PT1H"))
+	d, err := DiffSpecs(current, desired)
+	assert.NoError(t, err)
+	assert.True(t, d.Empty(), d.String())
+
+	desired = NewKafkaIngestionSpec(SetLabels(LabelSet{"job"}), SetTaskCount(2), SetTaskDuration("PT2H"), SetStartDelay("PT5S"))
+	d, err = DiffSpecs(current, desired)
+	assert.NoError(t, err)
+	assert.Equal(t, []ValueChange{{Path: "taskDuration", Current: "PT3600S", Desired: "PT7200S"}}, d.IOConfigChanges)
+}
+
+func TestDiffSpecs_Removals(t *testing.T) {
+	filter := Filter{Type: "selector", Dimension: "job", Value: "node"}
+	autoscaler := AutoScalerConfig{EnableTaskAutoScaler: true, AutoScalerStrategy: "lagBased", TaskCountMin: 1, TaskCountMax: 4}
+	var testData = []struct {
+		name    string
+		current KafkaIngestionSpecOptions
+		path    string
+	}{
+		{name: "ssl", current: ApplySSLConfig(), path: "consumerProperties.security.protocol"},
+		{name: "consumer property", current: SetConsumerProperty("fetch.min.bytes", 1024), path: "consumerProperties.fetch.min.bytes"},
+		{name: "task count", current: SetTaskCount(4), path: "taskCount"},
+		{name: "autoscaler", current: SetAutoScalerConfig(autoscaler), path: "autoScalerConfig"},
+		{name: "transform filter", current: SetTransformFilter(filter), path: "transformSpec"},
+		{name: "rollup", current: SetRollup(false), path: "granularitySpec.rollup"},
+	}
+
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			d, err := DiffSpecs(NewKafkaIngestionSpec(test.current), NewKafkaIngestionSpec())
+			assert.NoError(t, err)
+			assert.False(t, d.Empty())
+			var paths []string
+			for _, c := range append(d.IOConfigChanges, d.DataSchemaChanges...) {
+				paths = append(paths, c.Path)
+			}
+			assert.Contains(t, paths, test.path)
+		})
+	}
+
+	// Settings set to Druid's defaults are not a change.
+	d, err := DiffSpecs(NewKafkaIngestionSpec(SetTaskCount(1), SetStartDelay("PT5S")), NewKafkaIngestionSpec())
+	assert.NoError(t, err)
+	assert.True(t, d.Empty(), d.String())
+}
+
+func TestNormalizePeriod(t *testing.T) {
+	var testData = map[string]string{
+		"PT10M":   "PT600S",
+		"PT600S":  "PT600S",
+		"P1DT1H":  "PT90000S",
+		"P1W":     "PT604800S",
+		"PT0.5S":  "PT0.5S",
+		"P1M":     "P1M",
+		"invalid": "invalid",
+	}
+	for period, expected := range testData {
+		assert.Equal(t, expected, normalizePeriod(period), period)
+	}
+}
+
+func TestSpecDiff_String(t *testing.T) {
+	d := SpecDiff{
+		DimensionsAdded:   []string{"baz"},
+		DimensionsRemoved: []string{"bar"},
+		FieldsAdded: FieldList{
+			{Type: "path", Name: "baz", Expr: "$.labels.baz"},
+		},
+		FieldsRemoved: FieldList{
+			{Type: "path", Name: "bar", Expr: "$.labels.bar"},
+		},
+		MetricsAdded: []Metric{
+			{Name: "value", Type: "doubleSum", FieldName: "value"},
+		},
+		MetricsChanged: []MetricChange{
+			{
+				Name:    "count",
+				Current: Metric{Name: "count", Type: "count"},
+				Desired: Metric{Name: "count", Type: "longSum", FieldName: "count"},
+			},
+		},
+		DataSchemaChanges: []ValueChange{
+			{Path: "granularitySpec.rollup", Current: nil, Desired: false},
+		},
+		IOConfigChanges: []ValueChange{
+			{Path: "topic", Current: "prometheus", Desired: "test"},
+			{Path: "useEarliestOffset", Current: nil, Desired: true},
+		},
+	}
+	expected := `Dimensions added:
+  + baz
+Dimensions removed:
+  - bar
+Flatten fields added:
+  + baz (path $.labels.baz)
+Flatten fields removed:
+  - bar (path $.labels.bar)
+Metrics added:
+  + {"name":"value","type":"doubleSum","fieldName":"value"}
+Metrics changed:
+  ~ count: {"name":"count","type":"count"} -> {"name":"count","type":"longSum","fieldName":"count"}
+dataSchema changes:
+  ~ granularitySpec.rollup: <unset> -> false
+ioConfig changes:
+  ~ topic: "prometheus" -> "test"
+  ~ useEarliestOffset: <unset> -> true
+`
+	assert.Equal(t, expected, d.String())
+	assert.Equal(t, "", SpecDiff{}.String())
+}
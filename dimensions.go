@@ -0,0 +1,262 @@
+/*
+Copyright 2020 noris network AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingestion
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Dimension types supported by Druid.
+const (
+	DimensionTypeString = "string"
+	DimensionTypeLong   = "long"
+	DimensionTypeFloat  = "float"
+	DimensionTypeDouble = "double"
+	DimensionTypeJSON   = "json"
+)
+
+// multiValueHandlings are the modes of storing string dimensions with
+// several values.
+var multiValueHandlings = map[string]bool{
+	"SORTED_ARRAY": true,
+	"SORTED_SET":   true,
+	"ARRAY":        true,
+}
+
+// normalize drops the settings of the schema that equal Druid's defaults,
+// which Druid adds to the spec of a running supervisor. It reports whether the
+// schema is a plain string dimension.
+func (s *DimensionSchema) normalize() bool {
+	if s.Type == "" {
+		s.Type = DimensionTypeString
+	}
+	if s.MultiValueHandling == "SORTED_ARRAY" {
+		s.MultiValueHandling = ""
+	}
+	indexed := s.Type == DimensionTypeString || s.Type == DimensionTypeJSON
+	if s.CreateBitmapIndex != nil && *s.CreateBitmapIndex == indexed {
+		s.CreateBitmapIndex = nil
+	}
+	return s.Type == DimensionTypeString && s.CreateBitmapIndex == nil && s.MultiValueHandling == ""
+}
+
+// validate checks the type and the settings of the schema.
+func (s DimensionSchema) validate() error {
+	switch s.Type {
+	case DimensionTypeString:
+		if s.MultiValueHandling != "" && !multiValueHandlings[s.MultiValueHandling] {
+			return fmt.Errorf("unknown multiValueHandling %q", s.MultiValueHandling)
+		}
+	case DimensionTypeLong, DimensionTypeFloat, DimensionTypeDouble:
+		if s.MultiValueHandling != "" {
+			return fmt.Errorf("multiValueHandling is only supported by string dimensions")
+		}
+		if s.CreateBitmapIndex != nil && *s.CreateBitmapIndex {
+			return fmt.Errorf("bitmap indexes are only supported by string dimensions")
+		}
+	case DimensionTypeJSON:
+		if s.MultiValueHandling != "" || s.CreateBitmapIndex != nil {
+			return fmt.Errorf("json dimensions don't support multiValueHandling and createBitmapIndex")
+		}
+	default:
+		return fmt.Errorf("unknown type %q", s.Type)
+	}
+	return nil
+}
+
+// MarshalJSON marshals the dimensions with a schema as objects and all other
+// dimensions as strings.
+func (ds DimensionsSpec) MarshalJSON() ([]byte, error) {
+	dimensions := make([]interface{}, 0, len(ds.Dimensions))
+	for _, d := range ds.Dimensions {
+		if s, ok := ds.Schemas[d]; ok {
+			s.Name = d
+			dimensions = append(dimensions, s)
+			continue
+		}
+		dimensions = append(dimensions, d)
+	}
+	return json.Marshal(struct {
+		Dimensions          []interface{} `json:"dimensions"`
+		DimensionExclusions []string      `json:"dimensionExclusions,omitempty"`
+		UseSchemaDiscovery  bool          `json:"useSchemaDiscovery,omitempty"`
+	}{dimensions, ds.DimensionExclusions, ds.UseSchemaDiscovery})
+}
+
+// UnmarshalJSON accepts dimensions given as strings as well as dimension
+// schemas. Schemas of plain string dimensions are dropped.
+func (ds *DimensionsSpec) UnmarshalJSON(b []byte) error {
+	var raw struct {
+		Dimensions          []json.RawMessage `json:"dimensions"`
+		DimensionExclusions []string          `json:"dimensionExclusions"`
+		UseSchemaDiscovery  bool              `json:"useSchemaDiscovery"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	*ds = DimensionsSpec{
+		DimensionExclusions: raw.DimensionExclusions,
+		UseSchemaDiscovery:  raw.UseSchemaDiscovery,
+	}
+	if raw.Dimensions == nil {
+		return nil
+	}
+	ds.Dimensions = make(LabelSet, 0, len(raw.Dimensions))
+	for _, r := range raw.Dimensions {
+		var name string
+		if err := json.Unmarshal(r, &name); err == nil {
+			ds.Dimensions = append(ds.Dimensions, name)
+			continue
+		}
+		var s DimensionSchema
+		if err := json.Unmarshal(r, &s); err != nil {
+			return fmt.Errorf("dimension is neither a string nor an object: %s", string(r))
+		}
+		ds.Dimensions = append(ds.Dimensions, s.Name)
+		if !s.normalize() {
+			if ds.Schemas == nil {
+				ds.Schemas = make(map[string]DimensionSchema)
+			}
+			ds.Schemas[s.Name] = s
+		}
+	}
+	return nil
+}
+
+// sortedSchemaNames returns the names of the dimensions with a schema in
+// order.
+func (ds DimensionsSpec) sortedSchemaNames() []string {
+	names := make([]string, 0, len(ds.Schemas))
+	for name := range ds.Schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validateSchemas checks that the schemas are valid.
+func (ds DimensionsSpec) validateSchemas() error {
+	for _, name := range ds.sortedSchemaNames() {
+		if err := ds.Schemas[name].validate(); err != nil {
+			return fmt.Errorf("dimension %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// validateSchemaColumns checks that the schemas belong to dimensions of the
+// spec.
+func (ds DimensionsSpec) validateSchemaColumns() error {
+	for _, name := range ds.sortedSchemaNames() {
+		if !ds.Dimensions.Contains(name) {
+			return &UnknownColumnError{Context: "dimension schema", Column: name}
+		}
+	}
+	return nil
+}
+
+// updateDimensionSchema changes the schema of the dimension of a label or
+// transform. Labels are looked up by their flatten field, so it can be applied
+// after RenameCollidingLabels. Schemas of plain string dimensions are
+// removed.
+func (spec *KafkaIngestionSpec) updateDimensionSchema(name string, update func(*DimensionSchema)) {
+	for _, f := range spec.flattenSpec().Fields {
+		if l, ok := f.label(); ok && l == name {
+			name = f.Name
+			break
+		}
+	}
+	ds := spec.dimensionsSpec()
+	s, ok := ds.Schemas[name]
+	if !ok {
+		s = DimensionSchema{Type: DimensionTypeString}
+	}
+	update(&s)
+	if s.normalize() {
+		delete(ds.Schemas, name)
+		return
+	}
+	if ds.Schemas == nil {
+		ds.Schemas = make(map[string]DimensionSchema)
+	}
+	s.Name = name
+	ds.Schemas[name] = s
+}
+
+// SetDimensionType sets the type of the dimension of a label, e.g. 'double'
+// for 'le' or 'quantile'. Values that can't be parsed as numbers are stored
+// as null.
+func SetDimensionType(name, typ string) KafkaIngestionSpecOptions {
+	return func(spec *KafkaIngestionSpec) {
+		spec.updateDimensionSchema(name, func(s *DimensionSchema) {
+			s.Type = strings.ToLower(typ)
+			if s.Type != DimensionTypeString {
+				s.CreateBitmapIndex = nil
+			}
+		})
+	}
+}
+
+// DisableBitmapIndex stores the dimensions of the labels without bitmap
+// index, which saves space for labels with a high cardinality but makes
+// filtering on them slower.
+func DisableBitmapIndex(names ...string) KafkaIngestionSpecOptions {
+	return func(spec *KafkaIngestionSpec) {
+		for _, name := range names {
+			spec.updateDimensionSchema(name, func(s *DimensionSchema) {
+				s.CreateBitmapIndex = boolPointer(false)
+			})
+		}
+	}
+}
+
+// SetMultiValueHandling sets how a string dimension with several values is
+// stored, either 'SORTED_ARRAY', 'SORTED_SET' or 'ARRAY'.
+func SetMultiValueHandling(name, mode string) KafkaIngestionSpecOptions {
+	return func(spec *KafkaIngestionSpec) {
+		spec.updateDimensionSchema(name, func(s *DimensionSchema) {
+			s.MultiValueHandling = strings.ToUpper(mode)
+		})
+	}
+}
+
+// SetLabelsColumn ingests the labels object of the samples as a whole into a
+// nested 'json' dimension, which needs Druid 24 or newer. The spec stays valid
+// if labels come and go, and single labels can be queried with JSON_VALUE.
+// Labels set by SetLabels are promoted to dimensions of their own, so it has
+// to be applied after SetLabels.
+func SetLabelsColumn(column string) KafkaIngestionSpecOptions {
+	return func(spec *KafkaIngestionSpec) {
+		fs := spec.flattenSpec()
+		fs.Fields = append(fs.Fields, Field{Type: "path", Name: column, Expr: "$.labels"})
+		// The column is placed in front of the labels, which follow the 'name'
+		// dimension, so RenameCollidingLabels can tell them apart.
+		ds := spec.dimensionsSpec()
+		dimensions := LabelSet{"name", column}
+		if len(ds.Dimensions) > 0 {
+			dimensions = append(dimensions, ds.Dimensions[1:]...)
+		}
+		ds.Dimensions = dimensions
+		if ds.Schemas == nil {
+			ds.Schemas = make(map[string]DimensionSchema)
+		}
+		ds.Schemas[column] = DimensionSchema{Type: DimensionTypeJSON, Name: column}
+	}
+}
@@ -0,0 +1,181 @@
+/*
+Copyright 2020 noris network AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingestion
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDimensionSchemas(t *testing.T) {
+	spec := NewKafkaIngestionSpec(
+		SetLabels(LabelSet{"le", "pod", "name"}),
+		RenameCollidingLabels("label_"),
+		SetDimensionType("le", "double"),
+		DisableBitmapIndex("pod", "le"),
+		SetMultiValueHandling("name", "sorted_set"),
+	)
+	assert.NoError(t, spec.Validate())
+
+	actual, err := json.MarshalIndent(spec.dimensionsSpec(), "", "    ")
+	assert.NoError(t, err)
+	assert.Equal(t, `{
+    "dimensions": [
+        "name",
+        {
+            "type": "double",
+            "name": "le"
+        },
+        {
+            "type": "string",
+            "name": "pod",
+            "createBitmapIndex": false
+        },
+        {
+            "type": "string",
+            "name": "label_name",
+            "multiValueHandling": "SORTED_SET"
+        }
+    ]
+}`, string(actual))
+
+	var decoded DimensionsSpec
+	assert.NoError(t, json.Unmarshal(actual, &decoded))
+	assert.Equal(t, *spec.dimensionsSpec(), decoded)
+
+	// Resetting a dimension to a plain string dimension removes its schema.
+	SetDimensionType("le", "string")(spec)
+	assert.NotContains(t, spec.dimensionsSpec().Schemas, "le")
+}
+
+func TestDimensionsSpec_UnmarshalJSON(t *testing.T) {
+	var ds DimensionsSpec
+	assert.NoError(t, json.Unmarshal([]byte(`{"dimensions": [
+		"name",
+		{"type": "string", "name": "job", "multiValueHandling": "SORTED_ARRAY", "createBitmapIndex": true},
+		{"type": "long", "name": "shard", "multiValueHandling": "SORTED_ARRAY", "createBitmapIndex": false}
+	]}`), &ds))
+	assert.Equal(t, DimensionsSpec{
+		Dimensions: LabelSet{"name", "job", "shard"},
+		Schemas: map[string]DimensionSchema{
+			"shard": {Type: "long", Name: "shard"},
+		},
+	}, ds)
+
+	assert.Error(t, json.Unmarshal([]byte(`{"dimensions": [1]}`), &ds))
+}
+
+func TestDimensionsSpec_ValidateSchemas(t *testing.T) {
+	var testData = []struct {
+		name    string
+		options []KafkaIngestionSpecOptions
+		err     bool
+	}{
+		{
+			name:    "long",
+			options: []KafkaIngestionSpecOptions{SetDimensionType("shard", "long")},
+		},
+		{
+			name:    "unknown type",
+			options: []KafkaIngestionSpecOptions{SetDimensionType("shard", "int")},
+			err:     true,
+		},
+		{
+			name:    "unknown dimension",
+			options: []KafkaIngestionSpecOptions{SetDimensionType("le", "double")},
+			err:     true,
+		},
+		{
+			name:    "unknown multi value handling",
+			options: []KafkaIngestionSpecOptions{SetMultiValueHandling("shard", "list")},
+			err:     true,
+		},
+		{
+			name: "multi value handling of numbers",
+			options: []KafkaIngestionSpecOptions{
+				SetDimensionType("shard", "long"),
+				SetMultiValueHandling("shard", "SORTED_SET"),
+			},
+			err: true,
+		},
+	}
+
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			options := append([]KafkaIngestionSpecOptions{SetLabels(LabelSet{"shard"})}, test.options...)
+			err := NewKafkaIngestionSpec(options...).Validate()
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestUnknownColumnError(t *testing.T) {
+	var unknown *UnknownColumnError
+	err := NewKafkaIngestionSpec(SetDimensionType("le", "double")).Validate()
+	assert.True(t, errors.As(err, &unknown))
+	assert.Equal(t, "le", unknown.Column)
+	assert.Equal(t, `invalid dimensionsSpec: dimension schema: unknown column "le"`, err.Error())
+
+	err = NewKafkaIngestionSpec(AddMetrics(Metric{Name: "job_last", Type: "stringLast", FieldName: "job"})).Validate()
+	assert.True(t, errors.As(err, &unknown))
+	assert.Equal(t, `metric "job_last": unknown column "job"`, unknown.Error())
+
+	// Unknown columns are checked last.
+	err = NewKafkaIngestionSpec(SetDimensionType("le", "double"), SetTaskDuration("1h")).Validate()
+	assert.False(t, errors.As(err, &unknown))
+	assert.Error(t, err)
+}
+
+func TestSetLabelsColumn(t *testing.T) {
+	spec := NewKafkaIngestionSpec(
+		SetLabels(LabelSet{"job"}),
+		SetLabelsColumn("labels"),
+		SetSpecMode(SpecModeModern),
+	)
+	assert.NoError(t, spec.Validate())
+	assert.Equal(t, LabelSet{"job"}, spec.Labels())
+	assert.Contains(t, spec.flattenSpec().Fields, Field{Type: "path", Name: "labels", Expr: "$.labels"})
+
+	actual, err := json.MarshalIndent(spec.dimensionsSpec(), "", "    ")
+	assert.NoError(t, err)
+	assert.Equal(t, `{
+    "dimensions": [
+        "name",
+        {
+            "type": "json",
+            "name": "labels"
+        },
+        "job"
+    ]
+}`, string(actual))
+
+	spec = NewKafkaIngestionSpec(SetLabelsColumn("labels"))
+	assert.NoError(t, spec.Validate())
+	assert.Equal(t, LabelSet{"name", "labels"}, spec.dimensionsSpec().Dimensions)
+
+	// A label called like the column is renamed.
+	spec = NewKafkaIngestionSpec(SetLabels(LabelSet{"labels"}), SetLabelsColumn("labels"), RenameCollidingLabels("label_"))
+	assert.NoError(t, spec.Validate())
+	assert.Equal(t, LabelSet{"name", "labels", "label_labels"}, spec.dimensionsSpec().Dimensions)
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2020 noris network AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingestion
+
+import (
+	"fmt"
+)
+
+// SchemaMode selects how Druid determines the dimensions of the spec.
+type SchemaMode string
+
+const (
+	// SchemaModeExplicit lists the label dimensions in the spec.
+	SchemaModeExplicit SchemaMode = "explicit"
+	// SchemaModeDiscovery leaves the dimensions list empty, so Druid
+	// discovers the dimensions from the fields of the input rows.
+	SchemaModeDiscovery SchemaMode = "discovery"
+	// SchemaModeSchemaDiscovery additionally lets Druid detect the types of
+	// the dimensions and store nested objects as json columns, which needs
+	// Druid 26 or newer.
+	SchemaModeSchemaDiscovery SchemaMode = "schema-discovery"
+)
+
+// ParseSchemaMode converts a string to a SchemaMode.
+func ParseSchemaMode(s string) (SchemaMode, error) {
+	switch mode := SchemaMode(s); mode {
+	case SchemaModeExplicit, SchemaModeDiscovery, SchemaModeSchemaDiscovery:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown schema mode %q", s)
+	}
+}
+
+// SetSchemaMode lets Druid discover the dimensions. The root fields and the
+// flatten fields become dimensions, except for the 'value' and timestamp
+// columns and the given exclusions. Labels that are extracted without being
+// dimensions, e.g. for sketches or filters, are excluded as well, so it has to
+// be applied after all other options. With SchemaModeDiscovery the 'labels'
+// object is excluded, as Druid only discovers root fields, so only the labels
+// set by SetLabels are stored. With SchemaModeSchemaDiscovery it is stored as
+// a json column besides the extracted labels.
+//
+// The dimensions and their schemas are dropped, so the option can't be
+// undone. SchemaModeExplicit leaves the spec unchanged.
+func SetSchemaMode(mode SchemaMode, exclusions ...string) KafkaIngestionSpecOptions {
+	return func(spec *KafkaIngestionSpec) {
+		if mode == SchemaModeExplicit {
+			return
+		}
+		fs, ds := spec.flattenSpec(), spec.dimensionsSpec()
+		excluded := LabelSet{"value", spec.timestampSpec().Column}
+		if mode == SchemaModeDiscovery {
+			excluded = append(excluded, "labels")
+		}
+		for _, f := range fs.Fields {
+			if _, ok := f.label(); ok && !ds.Dimensions.Contains(f.Name) {
+				excluded = append(excluded, f.Name)
+			}
+		}
+
+		fs.UseFieldDiscovery = boolPointer(true)
+		ds.Dimensions = LabelSet{}
+		ds.Schemas = nil
+		ds.UseSchemaDiscovery = mode == SchemaModeSchemaDiscovery
+		ds.DimensionExclusions = excluded.Union(exclusions)
+	}
+}
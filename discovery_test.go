@@ -0,0 +1,73 @@
+/*
+Copyright 2020 noris network AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingestion
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSchemaMode(t *testing.T) {
+	mode, err := ParseSchemaMode("discovery")
+	assert.NoError(t, err)
+	assert.Equal(t, SchemaModeDiscovery, mode)
+
+	_, err = ParseSchemaMode("auto")
+	assert.Error(t, err)
+}
+
+func TestSetSchemaMode(t *testing.T) {
+	spec := NewKafkaIngestionSpec(
+		SetLabels(LabelSet{"job", "instance"}),
+		SetSpecMode(SpecModeModern),
+		AddDistinctCountSketches(SketchTypeHLL, 0, "pod"),
+		SetSchemaMode(SchemaModeDiscovery, "tmp"),
+	)
+	assert.NoError(t, spec.Validate())
+	assert.Equal(t, boolPointer(true), spec.flattenSpec().UseFieldDiscovery)
+	// the labels are still extracted, so Druid discovers them
+	assert.Equal(t, LabelSet{"job", "instance", "pod"}, spec.Labels())
+
+	// pod is only extracted for the sketch
+	actual, err := json.MarshalIndent(spec.dimensionsSpec(), "", "    ")
+	assert.NoError(t, err)
+	assert.Equal(t, `{
+    "dimensions": [],
+    "dimensionExclusions": [
+        "value",
+        "timestamp",
+        "labels",
+        "pod",
+        "tmp"
+    ]
+}`, string(actual))
+
+	spec = NewKafkaIngestionSpec(SetLabels(LabelSet{"job"}), SetSchemaMode(SchemaModeSchemaDiscovery))
+	assert.NoError(t, spec.Validate())
+	ds := spec.dimensionsSpec()
+	assert.True(t, ds.UseSchemaDiscovery)
+	// the labels are stored as a json column besides the extracted labels
+	assert.Equal(t, []string{"value", "timestamp"}, ds.DimensionExclusions)
+	assert.Equal(t, LabelSet{"job"}, spec.Labels())
+
+	// the explicit mode leaves the spec unchanged
+	spec = NewKafkaIngestionSpec(SetLabels(LabelSet{"job"}))
+	explicit := NewKafkaIngestionSpec(SetLabels(LabelSet{"job"}), SetSchemaMode(SchemaModeExplicit))
+	assert.Equal(t, spec, explicit)
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2020 noris network AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingestion
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// LabelFilter selects which of the discovered labels are used as dimensions.
+// It is applied between ExtractUniqueLabels and SetLabels.
+type LabelFilter struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+	require LabelSet
+}
+
+// LabelFilterOptions allows for configuring a LabelFilter.
+type LabelFilterOptions func(*LabelFilter) error
+
+// compileAnchored compiles a regular expression that has to match the whole
+// label name, like label matchers in PromQL.
+func compileAnchored(pattern string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid label pattern %q: %w", pattern, err)
+	}
+	return re, nil
+}
+
+// IncludeLabels only keeps labels matching at least one of the regular
+// expressions. The expressions have to match the whole label name.
+func IncludeLabels(patterns ...string) LabelFilterOptions {
+	return func(f *LabelFilter) error {
+		for _, p := range patterns {
+			re, err := compileAnchored(p)
+			if err != nil {
+				return err
+			}
+			f.include = append(f.include, re)
+		}
+		return nil
+	}
+}
+
+// ExcludeLabels drops labels matching any of the regular expressions. The
+// expressions have to match the whole label name.
+func ExcludeLabels(patterns ...string) LabelFilterOptions {
+	return func(f *LabelFilter) error {
+		for _, p := range patterns {
+			re, err := compileAnchored(p)
+			if err != nil {
+				return err
+			}
+			f.exclude = append(f.exclude, re)
+		}
+		return nil
+	}
+}
+
+// RequireLabels always adds the given labels, even if they weren't discovered
+// or are excluded.
+func RequireLabels(labels ...string) LabelFilterOptions {
+	return func(f *LabelFilter) error {
+		f.require = f.require.Union(labels)
+		return nil
+	}
+}
+
+// NewLabelFilter returns a LabelFilter that keeps all labels and applies any
+// options passed to it.
+func NewLabelFilter(options ...LabelFilterOptions) (*LabelFilter, error) {
+	f := &LabelFilter{
+		require: LabelSet{},
+	}
+	for _, fn := range options {
+		if err := fn(f); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// Apply returns the labels that pass the filter, followed by any required
+// labels that are missing.
+func (f *LabelFilter) Apply(labels LabelSet) LabelSet {
+	out := LabelSet{}
+	for _, l := range labels {
+		if f.matches(l) {
+			out = append(out, l)
+		}
+	}
+	return out.Union(f.require)
+}
+
+func (f *LabelFilter) matches(label string) bool {
+	for _, re := range f.exclude {
+		if re.MatchString(label) {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, re := range f.include {
+		if re.MatchString(label) {
+			return true
+		}
+	}
+	return false
+}
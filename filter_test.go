@@ -0,0 +1,89 @@
+/*
+Copyright 2020 noris network AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingestion
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLabelFilter(t *testing.T) {
+	var testData = []struct {
+		name     string
+		options  []LabelFilterOptions
+		in       LabelSet
+		expected LabelSet
+	}{
+		{
+			name:     "no options",
+			in:       LabelSet{"foo", "bar"},
+			expected: LabelSet{"foo", "bar"},
+		},
+		{
+			name:     "exclude",
+			options:  []LabelFilterOptions{ExcludeLabels("instance", "pod_.*")},
+			in:       LabelSet{"job", "instance", "pod_template_hash", "pod"},
+			expected: LabelSet{"job", "pod"},
+		},
+		{
+			name:     "include is anchored",
+			options:  []LabelFilterOptions{IncludeLabels("job|name.*")},
+			in:       LabelSet{"job", "namespace", "cronjob"},
+			expected: LabelSet{"job", "namespace"},
+		},
+		{
+			name: "exclude wins over include",
+			options: []LabelFilterOptions{
+				IncludeLabels(".*"),
+				ExcludeLabels("id"),
+			},
+			in:       LabelSet{"job", "id"},
+			expected: LabelSet{"job"},
+		},
+		{
+			name: "required labels are added",
+			options: []LabelFilterOptions{
+				ExcludeLabels("instance"),
+				RequireLabels("cluster", "instance"),
+			},
+			in:       LabelSet{"job", "instance"},
+			expected: LabelSet{"job", "cluster", "instance"},
+		},
+		{
+			name:     "empty input",
+			options:  []LabelFilterOptions{RequireLabels("cluster")},
+			in:       LabelSet{},
+			expected: LabelSet{"cluster"},
+		},
+	}
+
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			f, err := NewLabelFilter(test.options...)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, f.Apply(test.in))
+		})
+	}
+}
+
+func TestNewLabelFilter_InvalidPattern(t *testing.T) {
+	_, err := NewLabelFilter(IncludeLabels("("))
+	assert.Error(t, err)
+	_, err = NewLabelFilter(ExcludeLabels("["))
+	assert.Error(t, err)
+}
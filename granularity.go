@@ -0,0 +1,270 @@
+/*
+Copyright 2020 noris network AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingestion
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// simpleGranularities maps Druid's simple granularities to their periods.
+// 'NONE' and 'ALL' have no period.
+var simpleGranularities = map[string]string{
+	"NONE":           "",
+	"SECOND":         "PT1S",
+	"MINUTE":         "PT1M",
+	"FIVE_MINUTE":    "PT5M",
+	"TEN_MINUTE":     "PT10M",
+	"FIFTEEN_MINUTE": "PT15M",
+	"THIRTY_MINUTE":  "PT30M",
+	"HOUR":           "PT1H",
+	"SIX_HOUR":       "PT6H",
+	"EIGHT_HOUR":     "PT8H",
+	"DAY":            "P1D",
+	"WEEK":           "P1W",
+	"MONTH":          "P1M",
+	"QUARTER":        "P3M",
+	"YEAR":           "P1Y",
+	"ALL":            "",
+}
+
+// Granularity is a Druid granularity, either a simple granularity like 'HOUR'
+// or a period granularity with an optional time zone and origin. Simple
+// granularities are marshaled as strings, period granularities as objects.
+type Granularity struct {
+	Simple   string
+	Period   string
+	TimeZone string
+	Origin   string
+}
+
+// periodGranularity is the JSON object of a period granularity.
+type periodGranularity struct {
+	Type     string `json:"type"`
+	Period   string `json:"period,omitempty"`
+	TimeZone string `json:"timeZone,omitempty"`
+	Origin   string `json:"origin,omitempty"`
+}
+
+// ParseGranularity parses a simple granularity like 'hour' or an ISO-8601
+// period like 'PT1H'. With a time zone simple granularities are converted to
+// period granularities, as simple granularities are always in UTC.
+func ParseGranularity(s, timeZone string) (Granularity, error) {
+	simple := strings.ToUpper(s)
+	if period, ok := simpleGranularities[simple]; ok {
+		if timeZone == "" || period == "" {
+			return Granularity{Simple: simple}, nil
+		}
+		return Granularity{Period: period, TimeZone: timeZone}, nil
+	}
+	if err := ValidatePeriod(s); err != nil {
+		return Granularity{}, fmt.Errorf("%q is neither a simple granularity like 'HOUR' nor an ISO-8601 period", s)
+	}
+	return Granularity{Period: s, TimeZone: timeZone}, nil
+}
+
+// MarshalJSON marshals simple granularities as strings and period
+// granularities as objects.
+func (g Granularity) MarshalJSON() ([]byte, error) {
+	if g.Simple != "" {
+		return json.Marshal(g.Simple)
+	}
+	return json.Marshal(periodGranularity{
+		Type:     "period",
+		Period:   g.Period,
+		TimeZone: g.TimeZone,
+		Origin:   g.Origin,
+	})
+}
+
+// UnmarshalJSON accepts granularities given as strings as well as objects,
+// which is how Druid returns the spec of a running supervisor, e.g.
+// {"type": "none"}.
+func (g *Granularity) UnmarshalJSON(b []byte) error {
+	var simple string
+	if err := json.Unmarshal(b, &simple); err == nil {
+		*g = Granularity{Simple: strings.ToUpper(simple)}
+		return nil
+	}
+	var obj periodGranularity
+	if err := json.Unmarshal(b, &obj); err != nil {
+		return fmt.Errorf("granularity is neither a string nor an object: %s", string(b))
+	}
+	if obj.Type == "period" {
+		*g = Granularity{Period: obj.Period, TimeZone: obj.TimeZone, Origin: obj.Origin}
+		return nil
+	}
+	*g = Granularity{Simple: strings.ToUpper(obj.Type)}
+	return nil
+}
+
+func (g Granularity) String() string {
+	if g.Simple != "" {
+		return g.Simple
+	}
+	if g.TimeZone != "" {
+		return g.Period + " in " + g.TimeZone
+	}
+	return g.Period
+}
+
+// validate checks that the granularity is a known simple granularity or has
+// a valid period.
+func (g Granularity) validate() error {
+	switch {
+	case g.Simple != "" && g.Period != "":
+		return fmt.Errorf("granularity %q must not have a period", g.Simple)
+	case g.Simple != "":
+		if _, ok := simpleGranularities[g.Simple]; !ok {
+			return fmt.Errorf("unknown granularity %q", g.Simple)
+		}
+		return nil
+	}
+	return ValidatePeriod(g.Period)
+}
+
+// approximateDuration returns the approximate length of the granularity, with
+// months of 30 and years of 365 days. 'NONE' is the finest and 'ALL' the
+// coarsest granularity.
+func (g Granularity) approximateDuration() time.Duration {
+	switch g.Simple {
+	case "NONE":
+		return time.Millisecond
+	case "ALL":
+		return math.MaxInt64
+	}
+	period := g.Period
+	if g.Simple != "" {
+		period = simpleGranularities[g.Simple]
+	}
+	dateUnits := map[byte]time.Duration{'Y': 365 * 24 * time.Hour, 'M': 30 * 24 * time.Hour, 'W': 7 * 24 * time.Hour, 'D': 24 * time.Hour}
+	timeUnits := map[byte]time.Duration{'H': time.Hour, 'M': time.Minute, 'S': time.Second}
+	units := dateUnits
+	var d time.Duration
+	start := 1
+	for i := 1; i < len(period); i++ {
+		c := period[i]
+		if c == 'T' {
+			units = timeUnits
+			start = i + 1
+			continue
+		}
+		unit, ok := units[c]
+		if !ok {
+			continue
+		}
+		n, _ := strconv.ParseFloat(period[start:i], 64)
+		d += time.Duration(n * float64(unit))
+		start = i + 1
+	}
+	return d
+}
+
+// intervalLayouts are the ISO-8601 date and time formats accepted in
+// intervals.
+var intervalLayouts = []string{
+	"2006-01-02",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04:05Z07:00",
+	"2006-01-02T15:04:05.999999999Z07:00",
+}
+
+func parseIntervalTime(s string) (time.Time, bool) {
+	for _, layout := range intervalLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// ValidateInterval checks that s is an ISO-8601 interval of a start and an
+// end time, or of a time and a period, e.g. '2020-01-01/2020-02-01' or
+// '2020-01-01/P1M'.
+func ValidateInterval(s string) error {
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 {
+		return fmt.Errorf("%q is not an ISO-8601 interval, e.g. '2020-01-01/2020-02-01'", s)
+	}
+	start, startOK := parseIntervalTime(parts[0])
+	end, endOK := parseIntervalTime(parts[1])
+	switch {
+	case startOK && endOK:
+		if !start.Before(end) {
+			return fmt.Errorf("interval %q ends before it starts", s)
+		}
+		return nil
+	case startOK && ValidatePeriod(parts[1]) == nil, endOK && ValidatePeriod(parts[0]) == nil:
+		return nil
+	}
+	return fmt.Errorf("%q is not an ISO-8601 interval, e.g. '2020-01-01/2020-02-01'", s)
+}
+
+// Validate checks the granularities and intervals of the spec. The query
+// granularity must not be coarser than the segment granularity.
+func (g GranularitySpec) Validate() error {
+	if err := g.SegmentGranularity.validate(); err != nil {
+		return fmt.Errorf("segmentGranularity: %w", err)
+	}
+	if err := g.QueryGranularity.validate(); err != nil {
+		return fmt.Errorf("queryGranularity: %w", err)
+	}
+	if g.QueryGranularity.approximateDuration() > g.SegmentGranularity.approximateDuration() {
+		return fmt.Errorf("queryGranularity %s is coarser than segmentGranularity %s", g.QueryGranularity, g.SegmentGranularity)
+	}
+	for _, interval := range g.Intervals {
+		if err := ValidateInterval(interval); err != nil {
+			return fmt.Errorf("intervals: %w", err)
+		}
+	}
+	return nil
+}
+
+// SetSegmentGranularity sets the granularity of the time chunks of the
+// segments.
+func SetSegmentGranularity(g Granularity) KafkaIngestionSpecOptions {
+	return func(spec *KafkaIngestionSpec) {
+		spec.DataSchema.GranularitySpec.SegmentGranularity = g
+	}
+}
+
+// SetQueryGranularity sets the granularity timestamps are truncated to.
+func SetQueryGranularity(g Granularity) KafkaIngestionSpecOptions {
+	return func(spec *KafkaIngestionSpec) {
+		spec.DataSchema.GranularitySpec.QueryGranularity = g
+	}
+}
+
+// SetRollup sets whether rows with the same truncated timestamp and
+// dimensions are combined. Without rollup every sample is stored as a row.
+func SetRollup(rollup bool) KafkaIngestionSpecOptions {
+	return func(spec *KafkaIngestionSpec) {
+		spec.DataSchema.GranularitySpec.Rollup = &rollup
+	}
+}
+
+// SetIntervals sets the ISO-8601 intervals of the data to ingest, which is
+// used by batch ingestion.
+func SetIntervals(intervals ...string) KafkaIngestionSpecOptions {
+	return func(spec *KafkaIngestionSpec) {
+		spec.DataSchema.GranularitySpec.Intervals = intervals
+	}
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2020 noris network AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingestion
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseGranularity(t *testing.T) {
+	var testData = []struct {
+		in       string
+		timeZone string
+		expected Granularity
+		err      bool
+	}{
+		{in: "hour", expected: Granularity{Simple: "HOUR"}},
+		{in: "FIFTEEN_MINUTE", expected: Granularity{Simple: "FIFTEEN_MINUTE"}},
+		{in: "day", timeZone: "Europe/Berlin", expected: Granularity{Period: "P1D", TimeZone: "Europe/Berlin"}},
+		{in: "none", timeZone: "Europe/Berlin", expected: Granularity{Simple: "NONE"}},
+		{in: "PT2H", expected: Granularity{Period: "PT2H"}},
+		{in: "P1W", timeZone: "UTC", expected: Granularity{Period: "P1W", TimeZone: "UTC"}},
+		{in: "fortnight", err: true},
+	}
+
+	for _, test := range testData {
+		t.Run(test.in, func(t *testing.T) {
+			actual, err := ParseGranularity(test.in, test.timeZone)
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestGranularity_JSON(t *testing.T) {
+	spec := GranularitySpec{
+		Type:               "uniform",
+		SegmentGranularity: Granularity{Period: "P1D", TimeZone: "Europe/Berlin"},
+		QueryGranularity:   Granularity{Simple: "HOUR"},
+	}
+	actual, err := json.Marshal(spec)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"type":"uniform","segmentGranularity":{"type":"period","period":"P1D","timeZone":"Europe/Berlin"},"queryGranularity":"HOUR"}`, string(actual))
+
+	var decoded GranularitySpec
+	assert.NoError(t, json.Unmarshal(actual, &decoded))
+	assert.Equal(t, spec, decoded)
+
+	var g Granularity
+	assert.NoError(t, json.Unmarshal([]byte(`{"type":"none"}`), &g))
+	assert.Equal(t, Granularity{Simple: "NONE"}, g)
+	assert.Error(t, json.Unmarshal([]byte(`1`), &g))
+}
+
+func TestValidateInterval(t *testing.T) {
+	assert.NoError(t, ValidateInterval("2020-01-01/2020-02-01"))
+	assert.NoError(t, ValidateInterval("2020-01-01T00:00:00Z/2020-01-01T12:00:00.000+02:00"))
+	assert.NoError(t, ValidateInterval("2020-01-01/P1M"))
+	assert.NoError(t, ValidateInterval("P1D/2020-01-02"))
+	assert.Error(t, ValidateInterval("2020-02-01/2020-01-01"))
+	assert.Error(t, ValidateInterval("P1D/P2D"))
+	assert.Error(t, ValidateInterval("2020-01-01"))
+	assert.Error(t, ValidateInterval("yesterday/today"))
+}
+
+func TestGranularitySpec_Validate(t *testing.T) {
+	var testData = []struct {
+		name    string
+		options []KafkaIngestionSpecOptions
+		err     bool
+	}{
+		{
+			name: "default",
+		},
+		{
+			name: "raw resolution",
+			options: []KafkaIngestionSpecOptions{
+				SetSegmentGranularity(Granularity{Simple: "DAY"}),
+				SetQueryGranularity(Granularity{Simple: "NONE"}),
+				SetRollup(false),
+				SetIntervals("2020-01-01/2020-02-01"),
+			},
+		},
+		{
+			name: "period in time zone",
+			options: []KafkaIngestionSpecOptions{
+				SetSegmentGranularity(Granularity{Period: "P1D", TimeZone: "Europe/Berlin"}),
+				SetQueryGranularity(Granularity{Period: "PT15M", TimeZone: "Europe/Berlin"}),
+			},
+		},
+		{
+			name:    "equal granularities",
+			options: []KafkaIngestionSpecOptions{SetQueryGranularity(Granularity{Simple: "HOUR"})},
+		},
+		{
+			name:    "query coarser than segment",
+			options: []KafkaIngestionSpecOptions{SetQueryGranularity(Granularity{Period: "P1D"})},
+			err:     true,
+		},
+		{
+			name:    "all",
+			options: []KafkaIngestionSpecOptions{SetQueryGranularity(Granularity{Simple: "ALL"})},
+			err:     true,
+		},
+		{
+			name:    "unknown granularity",
+			options: []KafkaIngestionSpecOptions{SetSegmentGranularity(Granularity{Simple: "FORTNIGHT"})},
+			err:     true,
+		},
+		{
+			name:    "invalid period",
+			options: []KafkaIngestionSpecOptions{SetSegmentGranularity(Granularity{Period: "1D"})},
+			err:     true,
+		},
+		{
+			name:    "invalid interval",
+			options: []KafkaIngestionSpecOptions{SetIntervals("2020-01-01")},
+			err:     true,
+		},
+	}
+
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			err := NewKafkaIngestionSpec(test.options...).Validate()
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -16,21 +16,52 @@ limitations under the License.
 
 package ingestion
 
+import (
+	"fmt"
+)
+
+// SpecMode selects the layout of the generated ingestion spec.
+type SpecMode string
+
+const (
+	// SpecModeLegacy configures parsing through dataSchema.parser, which is
+	// deprecated in recent Druid versions.
+	SpecModeLegacy SpecMode = "legacy"
+	// SpecModeModern configures parsing through dataSchema.timestampSpec,
+	// dataSchema.dimensionsSpec and ioConfig.inputFormat.
+	SpecModeModern SpecMode = "modern"
+)
+
+// ParseSpecMode converts a string to a SpecMode.
+func ParseSpecMode(s string) (SpecMode, error) {
+	switch mode := SpecMode(s); mode {
+	case SpecModeLegacy, SpecModeModern:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown spec mode %q", s)
+	}
+}
+
 // KafkaIngestionSpec is the root-level type defining an ingestion spec used
 // by Apache Druid.
 type KafkaIngestionSpec struct {
-	Type       string     `json:"type"`
-	DataSchema DataSchema `json:"dataSchema"`
-	IOConfig   IOConfig   `json:"ioConfig"`
+	Type         string        `json:"type"`
+	DataSchema   DataSchema    `json:"dataSchema"`
+	IOConfig     IOConfig      `json:"ioConfig"`
+	TuningConfig *TuningConfig `json:"tuningConfig,omitempty"`
 }
 
 // DataSchema represents the Druid dataSchema spec.
-// Right now only the legacy spec is supported.
+// In legacy mode Parser is set, otherwise TimestampSpec and DimensionsSpec
+// are set and the input format is configured in IOConfig.
 type DataSchema struct {
 	DataSource      string          `json:"dataSource"`
-	Parser          Parser          `json:"parser"`
+	TimestampSpec   *TimestampSpec  `json:"timestampSpec,omitempty"`
+	DimensionsSpec  *DimensionsSpec `json:"dimensionsSpec,omitempty"`
+	Parser          *Parser         `json:"parser,omitempty"`
 	MetricsSpec     []Metric        `json:"metricsSpec"`
 	GranularitySpec GranularitySpec `json:"granularitySpec"`
+	TransformSpec   *TransformSpec  `json:"transformSpec,omitempty"`
 }
 
 // Parser is responsible for configuring a wide variety of items related to
@@ -57,14 +88,29 @@ type TimestampSpec struct {
 // FlattenSpec responsible for bridging the gap between potentially nested input
 // data (such as JSON, Avro, etc) and Druid's flat data model.
 type FlattenSpec struct {
-	Fields FieldList `json:"fields"`
+	UseFieldDiscovery *bool     `json:"useFieldDiscovery,omitempty"`
+	Fields            FieldList `json:"fields"`
 }
 
 // DimensionsSpec is responsible for configuring Druid's dimensions. They're a
 // set of columns in Druid's data model that can be used for grouping, filtering
 // or applying aggregations.
+//
+// Dimensions are string dimensions unless Schemas holds a DimensionSchema for
+// them, which are then marshaled as objects in the dimensions list.
 type DimensionsSpec struct {
-	Dimensions LabelSet `json:"dimensions"`
+	Dimensions          LabelSet                   `json:"dimensions"`
+	Schemas             map[string]DimensionSchema `json:"-"`
+	DimensionExclusions []string                   `json:"dimensionExclusions,omitempty"`
+	UseSchemaDiscovery  bool                       `json:"useSchemaDiscovery,omitempty"`
+}
+
+// DimensionSchema configures the type and indexing of a dimension.
+type DimensionSchema struct {
+	Type               string `json:"type"`
+	Name               string `json:"name"`
+	CreateBitmapIndex  *bool  `json:"createBitmapIndex,omitempty"`
+	MultiValueHandling string `json:"multiValueHandling,omitempty"`
 }
 
 // FieldList is a list of Fields.
@@ -77,41 +123,157 @@ type Field struct {
 	Expr string `json:"expr"`
 }
 
-// Metric is a Druid aggregator that is applied at ingestion time.
+// Metric is a Druid aggregator that is applied at ingestion time. Filter and
+// Aggregator are only set for aggregators of type 'filtered'.
 type Metric struct {
-	Name      string `json:"name"`
-	Type      string `json:"type"`
-	FieldName string `json:"fieldName,omitempty"`
+	Name       string  `json:"name"`
+	Type       string  `json:"type"`
+	FieldName  string  `json:"fieldName,omitempty"`
+	Filter     *Filter `json:"filter,omitempty"`
+	Aggregator *Metric `json:"aggregator,omitempty"`
+	// K, LgK and Size are the size parameters of the quantilesDoublesSketch,
+	// HLLSketchBuild and thetaSketch aggregators.
+	K    int `json:"k,omitempty"`
+	LgK  int `json:"lgK,omitempty"`
+	Size int `json:"size,omitempty"`
+}
+
+// Filter is a Druid filter, e.g. of type 'in' matching the values of a
+// dimension or of type 'expression' matching a Druid expression. A 'selector'
+// filter without value matches missing values.
+type Filter struct {
+	Type       string   `json:"type"`
+	Dimension  string   `json:"dimension,omitempty"`
+	Value      string   `json:"value,omitempty"`
+	Values     []string `json:"values,omitempty"`
+	Pattern    string   `json:"pattern,omitempty"`
+	Expression string   `json:"expression,omitempty"`
+	// Field is the filter negated by 'not', Fields are the filters combined
+	// by 'and' and 'or'.
+	Field  *Filter  `json:"field,omitempty"`
+	Fields []Filter `json:"fields,omitempty"`
 }
 
 // GranularitySpec allows for configuring operations such as data segment
 // partitioning, truncating timestamps, time chunk segmentation or roll-up.
 type GranularitySpec struct {
-	Type               string `json:"type"`
-	SegmentGranularity string `json:"segmentGranularity"`
-	QueryGranularity   string `json:"queryGranularity"`
+	Type               string      `json:"type"`
+	SegmentGranularity Granularity `json:"segmentGranularity"`
+	QueryGranularity   Granularity `json:"queryGranularity"`
+	Rollup             *bool       `json:"rollup,omitempty"`
+	Intervals          []string    `json:"intervals,omitempty"`
+}
+
+// TransformSpec transforms and filters the input rows before they are
+// ingested.
+type TransformSpec struct {
+	Transforms []Transform `json:"transforms,omitempty"`
+	Filter     *Filter     `json:"filter,omitempty"`
+}
+
+// Transform derives a column from the input row, e.g. with a Druid
+// expression of type 'expression'.
+type Transform struct {
+	Type       string `json:"type"`
+	Name       string `json:"name"`
+	Expression string `json:"expression"`
+}
+
+// InputFormat specifies how to parse input data. It replaces the legacy
+// Parser.
+type InputFormat struct {
+	Type        string      `json:"type"`
+	FlattenSpec FlattenSpec `json:"flattenSpec"`
 }
 
 // IOConfig influences how data is read into Druid from a source system. Right
-// now only Kafka is supported.
+// now only Kafka is supported. Either Topic or TopicPattern is set. Unset
+// optional fields are left to Druid's defaults.
 type IOConfig struct {
-	Topic              string                  `json:"topic"`
-	ConsumerProperties KafkaConsumerProperties `json:"consumerProperties"`
-	TaskDuration       string                  `json:"taskDuration"`
-	UseEarliestOffset  bool                    `json:"useEarliestOffset"`
+	Topic                       string                  `json:"topic,omitempty"`
+	TopicPattern                *string                 `json:"topicPattern,omitempty"`
+	InputFormat                 *InputFormat            `json:"inputFormat,omitempty"`
+	ConsumerProperties          KafkaConsumerProperties `json:"consumerProperties"`
+	PollTimeout                 *int64                  `json:"pollTimeout,omitempty"`
+	Replicas                    *int                    `json:"replicas,omitempty"`
+	TaskCount                   *int                    `json:"taskCount,omitempty"`
+	AutoScalerConfig            *AutoScalerConfig       `json:"autoScalerConfig,omitempty"`
+	TaskDuration                string                  `json:"taskDuration"`
+	StartDelay                  *string                 `json:"startDelay,omitempty"`
+	Period                      *string                 `json:"period,omitempty"`
+	UseEarliestOffset           bool                    `json:"useEarliestOffset"`
+	CompletionTimeout           *string                 `json:"completionTimeout,omitempty"`
+	LateMessageRejectionPeriod  *string                 `json:"lateMessageRejectionPeriod,omitempty"`
+	EarlyMessageRejectionPeriod *string                 `json:"earlyMessageRejectionPeriod,omitempty"`
 }
 
 // KafkaConsumerProperties is a set of properties that is passed to the Kafka
 // consumer.
 type KafkaConsumerProperties struct {
-	BootstrapServers      string            `json:"bootstrap.servers"`
-	SecurityProtocol      *string           `json:"security.protocol,omitempty"`
-	SSLTruststoreType     *string           `json:"ssl.truststore.type,omitempty"`
-	SSLEnabledProtocols   *string           `json:"ssl.enabled.protocols,omitempty"`
-	SSLTruststoreLocation *string           `json:"ssl.truststore.location,omitempty"`
-	SSLTruststorePassword *PasswordProvider `json:"ssl.truststore.password,omitempty"`
-	SSLKeystoreLocation   *string           `json:"ssl.keystore.location,omitempty"`
-	SSLKeystorePassword   *PasswordProvider `json:"ssl.keystore.password,omitempty"`
+	BootstrapServers                   string                 `json:"bootstrap.servers"`
+	SecurityProtocol                   *string                `json:"security.protocol,omitempty"`
+	SSLTruststoreType                  *string                `json:"ssl.truststore.type,omitempty"`
+	SSLEnabledProtocols                *string                `json:"ssl.enabled.protocols,omitempty"`
+	SSLTruststoreLocation              *string                `json:"ssl.truststore.location,omitempty"`
+	SSLTruststorePassword              *PasswordProvider      `json:"ssl.truststore.password,omitempty"`
+	SSLKeystoreType                    *string                `json:"ssl.keystore.type,omitempty"`
+	SSLKeystoreLocation                *string                `json:"ssl.keystore.location,omitempty"`
+	SSLKeystorePassword                *PasswordProvider      `json:"ssl.keystore.password,omitempty"`
+	SSLKeyPassword                     *PasswordProvider      `json:"ssl.key.password,omitempty"`
+	SSLEndpointIdentificationAlgorithm *string                `json:"ssl.endpoint.identification.algorithm,omitempty"`
+	SASLMechanism                      *string                `json:"sasl.mechanism,omitempty"`
+	DynamicConfigProvider              *DynamicConfigProvider `json:"druid.dynamic.config.provider,omitempty"`
+	// Extra holds properties that are not modeled by the fields above. They
+	// are merged into the JSON object and must not use the keys of the
+	// fields above.
+	Extra map[string]interface{} `json:"-"`
+}
+
+// TuningConfig is used to tune the Kafka supervisor and its indexing tasks.
+// Unset fields are left to Druid's defaults.
+type TuningConfig struct {
+	Type                             string                        `json:"type"`
+	MaxRowsInMemory                  *int                          `json:"maxRowsInMemory,omitempty"`
+	MaxBytesInMemory                 *int64                        `json:"maxBytesInMemory,omitempty"`
+	MaxRowsPerSegment                *int                          `json:"maxRowsPerSegment,omitempty"`
+	MaxTotalRows                     *int64                        `json:"maxTotalRows,omitempty"`
+	IntermediatePersistPeriod        *string                       `json:"intermediatePersistPeriod,omitempty"`
+	MaxPendingPersists               *int                          `json:"maxPendingPersists,omitempty"`
+	IndexSpec                        *IndexSpec                    `json:"indexSpec,omitempty"`
+	IndexSpecForIntermediatePersists *IndexSpec                    `json:"indexSpecForIntermediatePersists,omitempty"`
+	ReportParseExceptions            *bool                         `json:"reportParseExceptions,omitempty"`
+	HandoffConditionTimeout          *int64                        `json:"handoffConditionTimeout,omitempty"`
+	ResetOffsetAutomatically         *bool                         `json:"resetOffsetAutomatically,omitempty"`
+	WorkerThreads                    *int                          `json:"workerThreads,omitempty"`
+	ChatThreads                      *int                          `json:"chatThreads,omitempty"`
+	ChatRetries                      *int                          `json:"chatRetries,omitempty"`
+	HTTPTimeout                      *string                       `json:"httpTimeout,omitempty"`
+	ShutdownTimeout                  *string                       `json:"shutdownTimeout,omitempty"`
+	OffsetFetchPeriod                *string                       `json:"offsetFetchPeriod,omitempty"`
+	SegmentWriteOutMediumFactory     *SegmentWriteOutMediumFactory `json:"segmentWriteOutMediumFactory,omitempty"`
+	IntermediateHandoffPeriod        *string                       `json:"intermediateHandoffPeriod,omitempty"`
+	LogParseExceptions               *bool                         `json:"logParseExceptions,omitempty"`
+	MaxParseExceptions               *int                          `json:"maxParseExceptions,omitempty"`
+	MaxSavedParseExceptions          *int                          `json:"maxSavedParseExceptions,omitempty"`
+}
+
+// IndexSpec configures how segments are indexed and compressed.
+type IndexSpec struct {
+	Bitmap               *Bitmap `json:"bitmap,omitempty"`
+	DimensionCompression string  `json:"dimensionCompression,omitempty"`
+	MetricCompression    string  `json:"metricCompression,omitempty"`
+	LongEncoding         string  `json:"longEncoding,omitempty"`
+}
+
+// Bitmap configures the bitmap index type, either 'roaring' or 'concise'.
+type Bitmap struct {
+	Type string `json:"type"`
+}
+
+// SegmentWriteOutMediumFactory configures the medium used for writing
+// segments, either 'tmpFile', 'offHeapMemory' or 'onHeapMemory'.
+type SegmentWriteOutMediumFactory struct {
+	Type string `json:"type"`
 }
 
 // PasswordProvider allows Druid to configure secrets via environment variables.
@@ -120,13 +282,21 @@ type PasswordProvider struct {
 	Variable string `json:"variable"`
 }
 
+// DynamicConfigProvider allows Druid to read arbitrary consumer properties
+// from environment variables. Variables maps property names to the names of
+// the environment variables.
+type DynamicConfigProvider struct {
+	Type      string            `json:"type"`
+	Variables map[string]string `json:"variables"`
+}
+
 // defaultKafkaIngestionSpec returns a default KafkaIngestionSpec
 func defaultKafkaIngestionSpec() *KafkaIngestionSpec {
 	spec := &KafkaIngestionSpec{
 		Type: "kafka",
 		DataSchema: DataSchema{
 			DataSource: "prometheus",
-			Parser: Parser{
+			Parser: &Parser{
 				Type: "string",
 				ParseSpec: ParseSpec{
 					Format: "json",
@@ -155,8 +325,8 @@ func defaultKafkaIngestionSpec() *KafkaIngestionSpec {
 			},
 			GranularitySpec: GranularitySpec{
 				Type:               "uniform",
-				SegmentGranularity: "HOUR",
-				QueryGranularity:   "MINUTE",
+				SegmentGranularity: Granularity{Simple: "HOUR"},
+				QueryGranularity:   Granularity{Simple: "MINUTE"},
 			},
 		},
 		IOConfig: IOConfig{
@@ -171,6 +341,127 @@ func defaultKafkaIngestionSpec() *KafkaIngestionSpec {
 	return spec
 }
 
+// Mode returns the SpecMode the spec is currently laid out in.
+func (spec *KafkaIngestionSpec) Mode() SpecMode {
+	if spec.DataSchema.Parser != nil {
+		return SpecModeLegacy
+	}
+	return SpecModeModern
+}
+
+// Labels returns the Prometheus labels that are extracted by the spec's
+// flatten fields.
+func (spec *KafkaIngestionSpec) Labels() LabelSet {
+	labels := LabelSet{}
+	for _, f := range specFields(spec) {
+		if l, ok := f.label(); ok {
+			labels = append(labels, l)
+		}
+	}
+	return labels
+}
+
+// flattenSpec returns the FlattenSpec of the spec, regardless of its mode. A
+// missing inputFormat is created, e.g. for a spec of a running supervisor.
+func (spec *KafkaIngestionSpec) flattenSpec() *FlattenSpec {
+	if spec.DataSchema.Parser != nil {
+		return &spec.DataSchema.Parser.ParseSpec.FlattenSpec
+	}
+	if spec.IOConfig.InputFormat == nil {
+		spec.IOConfig.InputFormat = &InputFormat{Type: "json"}
+	}
+	return &spec.IOConfig.InputFormat.FlattenSpec
+}
+
+// dimensionsSpec returns the DimensionsSpec of the spec, regardless of its
+// mode. A missing dimensionsSpec is created.
+func (spec *KafkaIngestionSpec) dimensionsSpec() *DimensionsSpec {
+	if spec.DataSchema.Parser != nil {
+		return &spec.DataSchema.Parser.ParseSpec.DimensionsSpec
+	}
+	if spec.DataSchema.DimensionsSpec == nil {
+		spec.DataSchema.DimensionsSpec = &DimensionsSpec{}
+	}
+	return spec.DataSchema.DimensionsSpec
+}
+
+// timestampSpec returns the TimestampSpec of the spec, regardless of its mode.
+// A missing timestampSpec is created with Druid's defaults.
+func (spec *KafkaIngestionSpec) timestampSpec() *TimestampSpec {
+	if spec.DataSchema.Parser != nil {
+		return &spec.DataSchema.Parser.ParseSpec.TimeStampSpec
+	}
+	if spec.DataSchema.TimestampSpec == nil {
+		spec.DataSchema.TimestampSpec = &TimestampSpec{Column: "timestamp", Format: "auto"}
+	}
+	return spec.DataSchema.TimestampSpec
+}
+
+// setMode moves the parsing configuration of the spec to the location used by
+// the given SpecMode.
+func (spec *KafkaIngestionSpec) setMode(mode SpecMode) {
+	if spec.Mode() == mode {
+		return
+	}
+	timestampSpec := *spec.timestampSpec()
+	flattenSpec := *spec.flattenSpec()
+	dimensionsSpec := *spec.dimensionsSpec()
+	switch mode {
+	case SpecModeLegacy:
+		spec.DataSchema.Parser = &Parser{
+			Type: "string",
+			ParseSpec: ParseSpec{
+				Format:         "json",
+				TimeStampSpec:  timestampSpec,
+				FlattenSpec:    flattenSpec,
+				DimensionsSpec: dimensionsSpec,
+			},
+		}
+		spec.DataSchema.TimestampSpec = nil
+		spec.DataSchema.DimensionsSpec = nil
+		spec.IOConfig.InputFormat = nil
+	case SpecModeModern:
+		spec.DataSchema.TimestampSpec = &timestampSpec
+		spec.DataSchema.DimensionsSpec = &dimensionsSpec
+		spec.IOConfig.InputFormat = &InputFormat{
+			Type:        "json",
+			FlattenSpec: flattenSpec,
+		}
+		spec.DataSchema.Parser = nil
+	}
+}
+
+// Validate checks the spec for errors that would make Druid reject it, e.g.
+// labels colliding with reserved columns. Columns referenced by dimension
+// schemas and metrics are checked last, so an UnknownColumnError means that
+// the rest of the spec is valid, e.g. if its labels aren't discovered yet.
+func (spec *KafkaIngestionSpec) Validate() error {
+	if err := spec.validateColumns(); err != nil {
+		return err
+	}
+	if err := spec.dimensionsSpec().validateSchemas(); err != nil {
+		return fmt.Errorf("invalid dimensionsSpec: %w", err)
+	}
+	if err := spec.validateMetrics(); err != nil {
+		return err
+	}
+	if err := spec.DataSchema.GranularitySpec.Validate(); err != nil {
+		return fmt.Errorf("invalid granularitySpec: %w", err)
+	}
+	if ts := spec.DataSchema.TransformSpec; ts != nil {
+		if err := ts.Validate(); err != nil {
+			return fmt.Errorf("invalid transformSpec: %w", err)
+		}
+	}
+	if err := spec.IOConfig.Validate(); err != nil {
+		return fmt.Errorf("invalid ioConfig: %w", err)
+	}
+	if err := spec.dimensionsSpec().validateSchemaColumns(); err != nil {
+		return fmt.Errorf("invalid dimensionsSpec: %w", err)
+	}
+	return spec.validateMetricFields()
+}
+
 // NewKafkaIngestionSpec returns a default KafkaIngestionSpec and applies any
 // options passed to it.
 func NewKafkaIngestionSpec(options ...KafkaIngestionSpecOptions) *KafkaIngestionSpec {
@@ -179,9 +179,132 @@ var (
         "taskDuration": "PT10M",
         "useEarliestOffset": true
     }
+}`
+	jsonModern = `{
+    "type": "kafka",
+    "dataSchema": {
+        "dataSource": "test",
+        "timestampSpec": {
+            "column": "timestamp",
+            "format": "iso"
+        },
+        "dimensionsSpec": {
+            "dimensions": [
+                "name",
+                "instance",
+                "job"
+            ]
+        },
+        "metricsSpec": [
+            {
+                "name": "count",
+                "type": "count"
+            },
+            {
+                "name": "value",
+                "type": "doubleMax",
+                "fieldName": "value"
+            }
+        ],
+        "granularitySpec": {
+            "type": "uniform",
+            "segmentGranularity": "HOUR",
+            "queryGranularity": "MINUTE"
+        }
+    },
+    "ioConfig": {
+        "topic": "test",
+        "inputFormat": {
+            "type": "json",
+            "flattenSpec": {
+                "fields": [
+                    {
+                        "type": "path",
+                        "name": "instance",
+                        "expr": "$.labels.instance"
+                    },
+                    {
+                        "type": "path",
+                        "name": "job",
+                        "expr": "$.labels.job"
+                    },
+                    {
+                        "type": "root",
+                        "name": "name",
+                        "expr": "name"
+                    },
+                    {
+                        "type": "root",
+                        "name": "value",
+                        "expr": "value"
+                    }
+                ]
+            }
+        },
+        "consumerProperties": {
+            "bootstrap.servers": "test"
+        },
+        "taskDuration": "PT10M",
+        "useEarliestOffset": true
+    }
+}`
+	jsonTuning = `{
+    "type": "kafka",
+    "maxRowsInMemory": 100000,
+    "maxRowsPerSegment": 5000000,
+    "intermediatePersistPeriod": "PT10M",
+    "indexSpec": {
+        "bitmap": {
+            "type": "roaring"
+        },
+        "dimensionCompression": "lz4"
+    },
+    "resetOffsetAutomatically": true
 }`
 )
 
+func TestParseSpecMode(t *testing.T) {
+	var testData = []struct {
+		in       string
+		expected SpecMode
+		err      bool
+	}{
+		{in: "legacy", expected: SpecModeLegacy},
+		{in: "modern", expected: SpecModeModern},
+		{in: "foo", err: true},
+	}
+
+	for _, test := range testData {
+		t.Run(test.in, func(t *testing.T) {
+			actual, err := ParseSpecMode(test.in)
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestKafkaIngestionSpec_MissingSpecs(t *testing.T) {
+	// e.g. a spec of a running supervisor without parser and inputFormat
+	spec := &KafkaIngestionSpec{}
+	assert.NotPanics(t, func() {
+		assert.Error(t, spec.Validate())
+		assert.Equal(t, "job", spec.labelColumn("job"))
+		SetSchemaMode(SchemaModeDiscovery)(spec)
+	})
+	assert.Equal(t, &InputFormat{
+		Type: "json",
+		FlattenSpec: FlattenSpec{
+			UseFieldDiscovery: boolPointer(true),
+			Fields:            FieldList{{Type: "path", Name: "job", Expr: "$.labels.job"}},
+		},
+	}, spec.IOConfig.InputFormat)
+	assert.Equal(t, &TimestampSpec{Column: "timestamp", Format: "auto"}, spec.DataSchema.TimestampSpec)
+}
+
 func TestKafkaIngestionSpec(t *testing.T) {
 	var testData = []struct {
 		name     string
@@ -325,6 +448,106 @@ func TestKafkaIngestionSpec(t *testing.T) {
 				return out
 			}(),
 		},
+		{
+			name: "modern spec mode, labels set before mode",
+			options: []KafkaIngestionSpecOptions{
+				SetLabels(LabelSet{"foo"}),
+				SetSpecMode(SpecModeModern),
+			},
+			expected: func() *KafkaIngestionSpec {
+				out := defaultKafkaIngestionSpec()
+				out.DataSchema.Parser = nil
+				out.DataSchema.TimestampSpec = &TimestampSpec{
+					Column: "timestamp",
+					Format: "iso",
+				}
+				out.DataSchema.DimensionsSpec = &DimensionsSpec{
+					Dimensions: []string{"name", "foo"},
+				}
+				out.IOConfig.InputFormat = &InputFormat{
+					Type: "json",
+					FlattenSpec: FlattenSpec{
+						Fields: FieldList{
+							Field{
+								Type: "path",
+								Name: "foo",
+								Expr: "$.labels.foo",
+							},
+							Field{
+								Type: "root",
+								Name: "name",
+								Expr: "name",
+							},
+							Field{
+								Type: "root",
+								Name: "value",
+								Expr: "value",
+							},
+						},
+					},
+				}
+				return out
+			}(),
+		},
+		{
+			name: "modern spec mode, labels set after mode",
+			options: []KafkaIngestionSpecOptions{
+				SetSpecMode(SpecModeModern),
+				SetLabels(LabelSet{"foo"}),
+			},
+			expected: NewKafkaIngestionSpec(
+				SetLabels(LabelSet{"foo"}),
+				SetSpecMode(SpecModeModern),
+			),
+		},
+		{
+			name: "switching back to legacy spec mode",
+			options: []KafkaIngestionSpecOptions{
+				SetSpecMode(SpecModeModern),
+				SetLabels(LabelSet{"foo"}),
+				SetSpecMode(SpecModeLegacy),
+			},
+			expected: NewKafkaIngestionSpec(
+				SetLabels(LabelSet{"foo"}),
+			),
+		},
+		{
+			name: "tuning config",
+			options: []KafkaIngestionSpecOptions{
+				SetMaxRowsInMemory(100000),
+				SetMaxRowsPerSegment(5000000),
+				SetIntermediatePersistPeriod("PT10M"),
+				SetIndexSpec(IndexSpec{Bitmap: &Bitmap{Type: "roaring"}}),
+				SetResetOffsetAutomatically(true),
+			},
+			expected: func() *KafkaIngestionSpec {
+				out := defaultKafkaIngestionSpec()
+				out.TuningConfig = &TuningConfig{
+					Type:                      "kafka",
+					MaxRowsInMemory:           intPointer(100000),
+					MaxRowsPerSegment:         intPointer(5000000),
+					IntermediatePersistPeriod: stringPointer("PT10M"),
+					IndexSpec:                 &IndexSpec{Bitmap: &Bitmap{Type: "roaring"}},
+					ResetOffsetAutomatically:  boolPointer(true),
+				}
+				return out
+			}(),
+		},
+		{
+			name: "tuning config replaced",
+			options: []KafkaIngestionSpecOptions{
+				SetMaxRowsInMemory(100000),
+				SetTuningConfig(TuningConfig{MaxRowsPerSegment: intPointer(10)}),
+			},
+			expected: func() *KafkaIngestionSpec {
+				out := defaultKafkaIngestionSpec()
+				out.TuningConfig = &TuningConfig{
+					Type:              "kafka",
+					MaxRowsPerSegment: intPointer(10),
+				}
+				return out
+			}(),
+		},
 	}
 
 	for _, test := range testData {
@@ -382,6 +605,54 @@ func TestKafkaIngestionSpec_MarshalJSON(t *testing.T) {
 		}
 		assert.Equal(t, spec, checkSpec)
 	})
+
+	t.Run("jsonModern", func(t *testing.T) {
+		spec := NewKafkaIngestionSpec(
+			SetSpecMode(SpecModeModern),
+			SetDataSource("test"),
+			SetTopic("test"),
+			SetBrokers("test"),
+			SetLabels(LabelSet{"instance", "job"}),
+		)
+		actual, err := json.MarshalIndent(spec, "", "    ")
+		if err != nil {
+			t.Fatalf("unexpected error while marshalling: %v", err)
+		}
+		expected := []byte(jsonModern)
+		assert.Equal(t, string(expected), string(actual), fmt.Sprintf("expected: %s\nactual: %s", string(expected), string(actual)))
+
+		var checkSpec *KafkaIngestionSpec
+		err = json.Unmarshal(actual, &checkSpec)
+		if err != nil {
+			t.Fatalf("unexpected error while unmarshalling: %v", err)
+		}
+		assert.Equal(t, spec, checkSpec)
+	})
+
+	t.Run("jsonTuning", func(t *testing.T) {
+		spec := NewKafkaIngestionSpec(
+			SetMaxRowsInMemory(100000),
+			SetMaxRowsPerSegment(5000000),
+			SetIntermediatePersistPeriod("PT10M"),
+			SetIndexSpec(IndexSpec{
+				Bitmap:               &Bitmap{Type: "roaring"},
+				DimensionCompression: "lz4",
+			}),
+			SetResetOffsetAutomatically(true),
+		)
+		actual, err := json.MarshalIndent(spec.TuningConfig, "", "    ")
+		if err != nil {
+			t.Fatalf("unexpected error while marshalling: %v", err)
+		}
+		expected := []byte(jsonTuning)
+		assert.Equal(t, string(expected), string(actual), fmt.Sprintf("expected: %s\nactual: %s", string(expected), string(actual)))
+	})
+}
+
+func TestKafkaIngestionSpec_Labels(t *testing.T) {
+	assert.Equal(t, LabelSet{}, NewKafkaIngestionSpec().Labels())
+	assert.Equal(t, LabelSet{"foo", "bar"}, NewKafkaIngestionSpec(SetLabels(LabelSet{"foo", "bar"})).Labels())
+	assert.Equal(t, LabelSet{"foo"}, NewKafkaIngestionSpec(SetLabels(LabelSet{"foo"}), SetSpecMode(SpecModeModern)).Labels())
 }
 
 var result *KafkaIngestionSpec
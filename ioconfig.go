@@ -0,0 +1,181 @@
+/*
+Copyright 2020 noris network AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingestion
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// periodPattern matches ISO-8601 periods like 'PT10M', 'P1D' or 'PT0.5S'.
+var periodPattern = regexp.MustCompile(`^P(\d+Y)?(\d+M)?(\d+W)?(\d+D)?(T(\d+H)?(\d+M)?(\d+(\.\d+)?S)?)?$`)
+
+// ValidatePeriod checks that s is an ISO-8601 period, e.g. 'PT1H'.
+func ValidatePeriod(s string) error {
+	if !periodPattern.MatchString(s) || s == "P" || strings.HasSuffix(s, "T") {
+		return fmt.Errorf("%q is not an ISO-8601 period, e.g. 'PT10M'", s)
+	}
+	return nil
+}
+
+// Validate checks the periods, counts and topic of the IOConfig as well as
+// the autoscaler and the consumer properties.
+func (c IOConfig) Validate() error {
+	if c.Topic == "" && c.TopicPattern == nil {
+		return errors.New("either topic or topicPattern must be set")
+	}
+	if c.Topic != "" && c.TopicPattern != nil {
+		return errors.New("topic and topicPattern must not both be set")
+	}
+	if c.TopicPattern != nil {
+		if _, err := regexp.Compile(*c.TopicPattern); err != nil {
+			return fmt.Errorf("topicPattern: %w", err)
+		}
+	}
+
+	periods := []struct {
+		name  string
+		value *string
+	}{
+		{"taskDuration", &c.TaskDuration},
+		{"startDelay", c.StartDelay},
+		{"period", c.Period},
+		{"completionTimeout", c.CompletionTimeout},
+		{"lateMessageRejectionPeriod", c.LateMessageRejectionPeriod},
+		{"earlyMessageRejectionPeriod", c.EarlyMessageRejectionPeriod},
+	}
+	for _, p := range periods {
+		if p.value == nil {
+			continue
+		}
+		if err := ValidatePeriod(*p.value); err != nil {
+			return fmt.Errorf("%s: %w", p.name, err)
+		}
+	}
+
+	counts := []struct {
+		name  string
+		value *int
+	}{
+		{"replicas", c.Replicas},
+		{"taskCount", c.TaskCount},
+	}
+	for _, n := range counts {
+		if n.value != nil && *n.value < 1 {
+			return fmt.Errorf("%s must be at least 1", n.name)
+		}
+	}
+	if c.PollTimeout != nil && *c.PollTimeout < 0 {
+		return errors.New("pollTimeout must not be negative")
+	}
+	if c.AutoScalerConfig != nil && c.AutoScalerConfig.EnableTaskAutoScaler {
+		if err := c.AutoScalerConfig.Validate(); err != nil {
+			return fmt.Errorf("autoScalerConfig: %w", err)
+		}
+	}
+
+	return c.ConsumerProperties.Validate()
+}
+
+// SetTopicPattern sets a regular expression matching the Kafka topics to
+// consume data from, instead of a single topic.
+func SetTopicPattern(pattern string) KafkaIngestionSpecOptions {
+	return func(spec *KafkaIngestionSpec) {
+		spec.IOConfig.Topic = ""
+		spec.IOConfig.TopicPattern = stringPointer(pattern)
+	}
+}
+
+// SetReplicas sets the number of replica sets of indexing tasks.
+func SetReplicas(replicas int) KafkaIngestionSpecOptions {
+	return func(spec *KafkaIngestionSpec) {
+		spec.IOConfig.Replicas = intPointer(replicas)
+	}
+}
+
+// SetTaskCount sets the maximum number of reading tasks in a replica set.
+func SetTaskCount(count int) KafkaIngestionSpecOptions {
+	return func(spec *KafkaIngestionSpec) {
+		spec.IOConfig.TaskCount = intPointer(count)
+	}
+}
+
+// SetTaskDuration sets the ISO-8601 period after which tasks stop reading and
+// publish their segments. E.g. 'PT1H'.
+func SetTaskDuration(period string) KafkaIngestionSpecOptions {
+	return func(spec *KafkaIngestionSpec) {
+		spec.IOConfig.TaskDuration = period
+	}
+}
+
+// SetStartDelay sets the ISO-8601 period to wait before the supervisor starts
+// managing tasks.
+func SetStartDelay(period string) KafkaIngestionSpecOptions {
+	return func(spec *KafkaIngestionSpec) {
+		spec.IOConfig.StartDelay = stringPointer(period)
+	}
+}
+
+// SetPeriod sets the ISO-8601 period of how often the supervisor executes its
+// management logic.
+func SetPeriod(period string) KafkaIngestionSpecOptions {
+	return func(spec *KafkaIngestionSpec) {
+		spec.IOConfig.Period = stringPointer(period)
+	}
+}
+
+// SetUseEarliestOffset configures whether a new supervisor starts reading
+// from the earliest or the latest offset.
+func SetUseEarliestOffset(earliest bool) KafkaIngestionSpecOptions {
+	return func(spec *KafkaIngestionSpec) {
+		spec.IOConfig.UseEarliestOffset = earliest
+	}
+}
+
+// SetCompletionTimeout sets the ISO-8601 period to wait for publishing tasks
+// before they are declared as failed.
+func SetCompletionTimeout(period string) KafkaIngestionSpecOptions {
+	return func(spec *KafkaIngestionSpec) {
+		spec.IOConfig.CompletionTimeout = stringPointer(period)
+	}
+}
+
+// SetLateMessageRejectionPeriod rejects messages with timestamps older than
+// the ISO-8601 period before the task was created.
+func SetLateMessageRejectionPeriod(period string) KafkaIngestionSpecOptions {
+	return func(spec *KafkaIngestionSpec) {
+		spec.IOConfig.LateMessageRejectionPeriod = stringPointer(period)
+	}
+}
+
+// SetEarlyMessageRejectionPeriod rejects messages with timestamps later than
+// the ISO-8601 period after the task reached its taskDuration.
+func SetEarlyMessageRejectionPeriod(period string) KafkaIngestionSpecOptions {
+	return func(spec *KafkaIngestionSpec) {
+		spec.IOConfig.EarlyMessageRejectionPeriod = stringPointer(period)
+	}
+}
+
+// SetPollTimeout sets the milliseconds to wait for the Kafka consumer to poll
+// records.
+func SetPollTimeout(ms int64) KafkaIngestionSpecOptions {
+	return func(spec *KafkaIngestionSpec) {
+		spec.IOConfig.PollTimeout = &ms
+	}
+}
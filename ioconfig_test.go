@@ -0,0 +1,94 @@
+/*
+Copyright 2020 noris network AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingestion
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidatePeriod(t *testing.T) {
+	for _, p := range []string{"PT10M", "P1D", "PT1H30M", "PT0.5S", "P1Y2M3DT4H5M6S", "P2W"} {
+		assert.NoError(t, ValidatePeriod(p), p)
+	}
+	for _, p := range []string{"", "P", "PT", "10M", "PT10", "P1DT", "pt10m", "PT-1M"} {
+		assert.Error(t, ValidatePeriod(p), p)
+	}
+}
+
+func TestIOConfigOptions(t *testing.T) {
+	spec := NewKafkaIngestionSpec(
+		SetTopicPattern("prometheus-.*"),
+		SetBrokers("kafka01:9092"),
+		SetReplicas(2),
+		SetTaskCount(4),
+		SetTaskDuration("PT1H"),
+		SetStartDelay("PT5S"),
+		SetPeriod("PT30S"),
+		SetUseEarliestOffset(false),
+		SetCompletionTimeout("PT30M"),
+		SetLateMessageRejectionPeriod("PT2H"),
+		SetEarlyMessageRejectionPeriod("PT2H"),
+		SetPollTimeout(100),
+	)
+	assert.NoError(t, spec.Validate())
+	actual, err := json.MarshalIndent(spec.IOConfig, "", "    ")
+	assert.NoError(t, err)
+	assert.Equal(t, `{
+    "topicPattern": "prometheus-.*",
+    "consumerProperties": {
+        "bootstrap.servers": "kafka01:9092"
+    },
+    "pollTimeout": 100,
+    "replicas": 2,
+    "taskCount": 4,
+    "taskDuration": "PT1H",
+    "startDelay": "PT5S",
+    "period": "PT30S",
+    "useEarliestOffset": false,
+    "completionTimeout": "PT30M",
+    "lateMessageRejectionPeriod": "PT2H",
+    "earlyMessageRejectionPeriod": "PT2H"
+}`, string(actual))
+
+	spec = NewKafkaIngestionSpec(SetTopicPattern("foo"), SetTopic("bar"))
+	assert.Equal(t, "bar", spec.IOConfig.Topic)
+	assert.Nil(t, spec.IOConfig.TopicPattern)
+}
+
+func TestIOConfig_Validate(t *testing.T) {
+	var testData = []struct {
+		name    string
+		options []KafkaIngestionSpecOptions
+	}{
+		{name: "invalid task duration", options: []KafkaIngestionSpecOptions{SetTaskDuration("10m")}},
+		{name: "invalid period", options: []KafkaIngestionSpecOptions{SetCompletionTimeout("PT")}},
+		{name: "no topic", options: []KafkaIngestionSpecOptions{SetTopic("")}},
+		{name: "invalid topic pattern", options: []KafkaIngestionSpecOptions{SetTopicPattern("(")}},
+		{name: "zero replicas", options: []KafkaIngestionSpecOptions{SetReplicas(0)}},
+		{name: "negative poll timeout", options: []KafkaIngestionSpecOptions{SetPollTimeout(-1)}},
+	}
+
+	assert.NoError(t, NewKafkaIngestionSpec().Validate())
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Error(t, NewKafkaIngestionSpec(test.options...).Validate())
+		})
+	}
+}
@@ -0,0 +1,259 @@
+/*
+Copyright 2020 noris network AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingestion
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SSLConfig configures how the Kafka consumer connects to the brokers via
+// SSL. Empty fields are left out of the consumer properties, as are the type
+// and passwords of a store without location. Passwords are never written into
+// the spec, Druid reads them from the given environment variables.
+type SSLConfig struct {
+	TruststoreType             string
+	TruststoreLocation         string
+	TruststorePasswordVariable string
+	KeystoreType               string
+	KeystoreLocation           string
+	KeystorePasswordVariable   string
+	KeyPasswordVariable        string
+	EnabledProtocols           string
+	// EndpointIdentificationAlgorithm is only set if not nil. An empty
+	// string disables the hostname verification of the brokers.
+	EndpointIdentificationAlgorithm *string
+}
+
+// DefaultSSLConfig returns the opinionated SSLConfig used by ApplySSLConfig.
+func DefaultSSLConfig() SSLConfig {
+	return SSLConfig{
+		TruststoreType:             "PKCS12",
+		TruststoreLocation:         "/var/private/ssl/truststore.p12",
+		TruststorePasswordVariable: "DRUID_TRUSTSTORE_PASSWORD",
+		KeystoreLocation:           "/var/private/ssl/keystore.p12",
+		KeystorePasswordVariable:   "DRUID_KEYSTORE_PASSWORD",
+		EnabledProtocols:           "TLSv1.2",
+	}
+}
+
+// optionalString returns nil for empty strings.
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// environmentPassword returns a PasswordProvider reading the password from
+// the environment variable, or nil if no variable is given.
+func environmentPassword(variable string) *PasswordProvider {
+	if variable == "" {
+		return nil
+	}
+	return &PasswordProvider{
+		Type:     "environment",
+		Variable: variable,
+	}
+}
+
+// SetSSLConfig configures the Kafka consumer to connect to the brokers via
+// SSL. It replaces any SSL settings applied before.
+func SetSSLConfig(cfg SSLConfig) KafkaIngestionSpecOptions {
+	return func(spec *KafkaIngestionSpec) {
+		p := &spec.IOConfig.ConsumerProperties
+		if p.SASLMechanism != nil {
+			p.SecurityProtocol = stringPointer("SASL_SSL")
+		} else {
+			p.SecurityProtocol = stringPointer("SSL")
+		}
+		p.SSLEnabledProtocols = optionalString(cfg.EnabledProtocols)
+		if cfg.TruststoreLocation == "" {
+			cfg.TruststoreType, cfg.TruststorePasswordVariable = "", ""
+		}
+		p.SSLTruststoreType = optionalString(cfg.TruststoreType)
+		p.SSLTruststoreLocation = optionalString(cfg.TruststoreLocation)
+		p.SSLTruststorePassword = environmentPassword(cfg.TruststorePasswordVariable)
+		if cfg.KeystoreLocation == "" {
+			cfg.KeystoreType, cfg.KeystorePasswordVariable, cfg.KeyPasswordVariable = "", "", ""
+		}
+		p.SSLKeystoreType = optionalString(cfg.KeystoreType)
+		p.SSLKeystoreLocation = optionalString(cfg.KeystoreLocation)
+		p.SSLKeystorePassword = environmentPassword(cfg.KeystorePasswordVariable)
+		p.SSLKeyPassword = environmentPassword(cfg.KeyPasswordVariable)
+		p.SSLEndpointIdentificationAlgorithm = nil
+		if cfg.EndpointIdentificationAlgorithm != nil {
+			p.SSLEndpointIdentificationAlgorithm = stringPointer(*cfg.EndpointIdentificationAlgorithm)
+		}
+	}
+}
+
+// SASLConfig configures SASL authentication of the Kafka consumer, e.g. with
+// the mechanism 'SCRAM-SHA-512' or 'PLAIN'. The JAAS config contains the
+// password, so it is never written into the spec. Druid reads it from the
+// environment variable JAASConfigVariable instead, e.g.
+//
+//	org.apache.kafka.common.security.scram.ScramLoginModule required username="druid" password="secret";
+type SASLConfig struct {
+	Mechanism          string
+	JAASConfigVariable string
+}
+
+// setDynamicConfig lets Druid read the consumer property from the environment
+// variable.
+func (p *KafkaConsumerProperties) setDynamicConfig(property, variable string) {
+	if p.DynamicConfigProvider == nil {
+		p.DynamicConfigProvider = &DynamicConfigProvider{
+			Type:      "environment",
+			Variables: map[string]string{},
+		}
+	}
+	p.DynamicConfigProvider.Variables[property] = variable
+}
+
+// SetSASLConfig configures SASL authentication of the Kafka consumer. The
+// security protocol is 'SASL_SSL' if SSL is configured, before or after this
+// option, and 'SASL_PLAINTEXT' otherwise.
+func SetSASLConfig(cfg SASLConfig) KafkaIngestionSpecOptions {
+	return func(spec *KafkaIngestionSpec) {
+		p := &spec.IOConfig.ConsumerProperties
+		if p.SecurityProtocol != nil && (*p.SecurityProtocol == "SSL" || *p.SecurityProtocol == "SASL_SSL") {
+			p.SecurityProtocol = stringPointer("SASL_SSL")
+		} else {
+			p.SecurityProtocol = stringPointer("SASL_PLAINTEXT")
+		}
+		p.SASLMechanism = stringPointer(cfg.Mechanism)
+		p.setDynamicConfig("sasl.jaas.config", cfg.JAASConfigVariable)
+	}
+}
+
+// consumerPropertyKeys returns the keys of the properties modeled by the
+// fields of KafkaConsumerProperties.
+func consumerPropertyKeys() map[string]bool {
+	keys := make(map[string]bool)
+	for k := range consumerPropertyFields(&KafkaConsumerProperties{}) {
+		keys[k] = true
+	}
+	return keys
+}
+
+// ConsumerPropertyConflictError is returned if extra consumer properties use
+// the keys of typed fields.
+type ConsumerPropertyConflictError struct {
+	Keys []string
+}
+
+func (e *ConsumerPropertyConflictError) Error() string {
+	return fmt.Sprintf("extra consumer properties conflict with typed properties: %s", strings.Join(e.Keys, ", "))
+}
+
+// Validate checks that the extra properties don't use the keys of typed
+// fields.
+func (p KafkaConsumerProperties) Validate() error {
+	keys := consumerPropertyKeys()
+	var conflicts []string
+	for k := range p.Extra {
+		if keys[k] {
+			conflicts = append(conflicts, k)
+		}
+	}
+	if len(conflicts) == 0 {
+		return nil
+	}
+	sort.Strings(conflicts)
+	return &ConsumerPropertyConflictError{Keys: conflicts}
+}
+
+// consumerProperties prevents recursion when (un)marshalling.
+type consumerProperties KafkaConsumerProperties
+
+// MarshalJSON appends the extra properties, sorted by key, to the typed
+// properties.
+func (p KafkaConsumerProperties) MarshalJSON() ([]byte, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(consumerProperties(p))
+	if err != nil || len(p.Extra) == 0 {
+		return b, err
+	}
+
+	keys := make([]string, 0, len(p.Extra))
+	for k := range p.Extra {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	buf.Write(b[:len(b)-1])
+	for i, k := range keys {
+		if i > 0 || len(b) > 2 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(p.Extra[k])
+		if err != nil {
+			return nil, fmt.Errorf("consumer property %q: %w", k, err)
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON collects properties that are not modeled by the typed fields
+// in Extra.
+func (p *KafkaConsumerProperties) UnmarshalJSON(b []byte) error {
+	var typed consumerProperties
+	if err := json.Unmarshal(b, &typed); err != nil {
+		return err
+	}
+	var all map[string]interface{}
+	if err := json.Unmarshal(b, &all); err != nil {
+		return err
+	}
+	for k := range consumerPropertyKeys() {
+		delete(all, k)
+	}
+	typed.Extra = nil
+	if len(all) > 0 {
+		typed.Extra = all
+	}
+	*p = KafkaConsumerProperties(typed)
+	return nil
+}
+
+// SetConsumerProperty sets a consumer property that is not modeled by
+// KafkaConsumerProperties, e.g. 'isolation.level'. Keys of typed properties
+// are rejected by Validate.
+func SetConsumerProperty(key string, value interface{}) KafkaIngestionSpecOptions {
+	return func(spec *KafkaIngestionSpec) {
+		p := &spec.IOConfig.ConsumerProperties
+		if p.Extra == nil {
+			p.Extra = make(map[string]interface{})
+		}
+		p.Extra[key] = value
+	}
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2020 noris network AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingestion
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetSSLConfig(t *testing.T) {
+	spec := NewKafkaIngestionSpec(
+		SetBrokers("kafka01:9093"),
+		ApplySSLConfig(),
+		SetSSLConfig(SSLConfig{
+			TruststoreType:                  "JKS",
+			TruststoreLocation:              "/etc/kafka/truststore.jks",
+			TruststorePasswordVariable:      "TRUSTSTORE_PASSWORD",
+			KeystoreType:                    "JKS",
+			KeystoreLocation:                "/etc/kafka/keystore.jks",
+			KeystorePasswordVariable:        "KEYSTORE_PASSWORD",
+			KeyPasswordVariable:             "KEY_PASSWORD",
+			EnabledProtocols:                "TLSv1.3",
+			EndpointIdentificationAlgorithm: stringPointer(""),
+		}),
+	)
+	actual, err := json.MarshalIndent(spec.IOConfig.ConsumerProperties, "", "    ")
+	assert.NoError(t, err)
+	assert.Equal(t, `{
+    "bootstrap.servers": "kafka01:9093",
+    "security.protocol": "SSL",
+    "ssl.truststore.type": "JKS",
+    "ssl.enabled.protocols": "TLSv1.3",
+    "ssl.truststore.location": "/etc/kafka/truststore.jks",
+    "ssl.truststore.password": {
+        "type": "environment",
+        "variable": "TRUSTSTORE_PASSWORD"
+    },
+    "ssl.keystore.type": "JKS",
+    "ssl.keystore.location": "/etc/kafka/keystore.jks",
+    "ssl.keystore.password": {
+        "type": "environment",
+        "variable": "KEYSTORE_PASSWORD"
+    },
+    "ssl.key.password": {
+        "type": "environment",
+        "variable": "KEY_PASSWORD"
+    },
+    "ssl.endpoint.identification.algorithm": ""
+}`, string(actual))
+}
+
+func TestSetSSLConfig_TruststoreOnly(t *testing.T) {
+	spec := NewKafkaIngestionSpec(
+		ApplySSLConfig(),
+		SetSSLConfig(SSLConfig{
+			TruststoreLocation:       "/etc/kafka/truststore.jks",
+			KeystorePasswordVariable: "KEYSTORE_PASSWORD",
+		}),
+	)
+	assert.Equal(t, KafkaConsumerProperties{
+		BootstrapServers:      defaultKafkaIngestionSpec().IOConfig.ConsumerProperties.BootstrapServers,
+		SecurityProtocol:      stringPointer("SSL"),
+		SSLTruststoreLocation: stringPointer("/etc/kafka/truststore.jks"),
+	}, spec.IOConfig.ConsumerProperties)
+}
+
+func TestSetSASLConfig(t *testing.T) {
+	cfg := SASLConfig{
+		Mechanism:          "SCRAM-SHA-512",
+		JAASConfigVariable: "KAFKA_JAAS_CONFIG",
+	}
+	provider := &DynamicConfigProvider{
+		Type:      "environment",
+		Variables: map[string]string{"sasl.jaas.config": "KAFKA_JAAS_CONFIG"},
+	}
+
+	spec := NewKafkaIngestionSpec(SetSASLConfig(cfg))
+	p := spec.IOConfig.ConsumerProperties
+	assert.Equal(t, stringPointer("SASL_PLAINTEXT"), p.SecurityProtocol)
+	assert.Equal(t, stringPointer("SCRAM-SHA-512"), p.SASLMechanism)
+	assert.Equal(t, provider, p.DynamicConfigProvider)
+
+	for _, opts := range [][]KafkaIngestionSpecOptions{
+		{ApplySSLConfig(), SetSASLConfig(cfg)},
+		{SetSASLConfig(cfg), ApplySSLConfig()},
+	} {
+		p := NewKafkaIngestionSpec(opts...).IOConfig.ConsumerProperties
+		assert.Equal(t, stringPointer("SASL_SSL"), p.SecurityProtocol)
+		assert.Equal(t, stringPointer("/var/private/ssl/truststore.p12"), p.SSLTruststoreLocation)
+		assert.Equal(t, provider, p.DynamicConfigProvider)
+	}
+
+	actual, err := json.Marshal(spec.IOConfig.ConsumerProperties)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(actual), "password")
+	assert.Contains(t, string(actual), `"druid.dynamic.config.provider":{"type":"environment","variables":{"sasl.jaas.config":"KAFKA_JAAS_CONFIG"}}`)
+}
+
+func TestSetConsumerProperty(t *testing.T) {
+	spec := NewKafkaIngestionSpec(
+		SetBrokers("kafka01:9092"),
+		SetConsumerProperty("max.poll.records", 500),
+		SetConsumerProperty("isolation.level", "read_committed"),
+	)
+	actual, err := json.Marshal(spec.IOConfig.ConsumerProperties)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"bootstrap.servers":"kafka01:9092","isolation.level":"read_committed","max.poll.records":500}`, string(actual))
+
+	var p KafkaConsumerProperties
+	assert.NoError(t, json.Unmarshal(actual, &p))
+	assert.Equal(t, KafkaConsumerProperties{
+		BootstrapServers: "kafka01:9092",
+		Extra: map[string]interface{}{
+			"isolation.level":  "read_committed",
+			"max.poll.records": float64(500),
+		},
+	}, p)
+
+	assert.NoError(t, json.Unmarshal([]byte(`{"bootstrap.servers":"kafka01:9092"}`), &p))
+	assert.Nil(t, p.Extra)
+}
+
+func TestSetConsumerProperty_Conflict(t *testing.T) {
+	spec := NewKafkaIngestionSpec(
+		SetConsumerProperty("security.protocol", "SSL"),
+		SetConsumerProperty("bootstrap.servers", "kafka01:9092"),
+	)
+	var conflict *ConsumerPropertyConflictError
+	assert.True(t, errors.As(spec.Validate(), &conflict))
+	assert.Equal(t, []string{"bootstrap.servers", "security.protocol"}, conflict.Keys)
+
+	_, err := json.Marshal(spec)
+	assert.Error(t, err)
+}
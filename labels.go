@@ -17,6 +17,7 @@ limitations under the License.
 package ingestion
 
 import (
+	"encoding/json"
 	"fmt"
 
 	"github.com/prometheus/common/model"
@@ -25,6 +26,35 @@ import (
 // LabelSet is a unique set of Prometheus labels.
 type LabelSet []string
 
+// UnmarshalJSON accepts dimensions given as plain strings as well as dimension
+// objects, which is how Druid returns the spec of a running supervisor.
+func (labels *LabelSet) UnmarshalJSON(b []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	if raw == nil {
+		return nil
+	}
+	out := make(LabelSet, 0, len(raw))
+	for _, r := range raw {
+		var name string
+		if err := json.Unmarshal(r, &name); err == nil {
+			out = append(out, name)
+			continue
+		}
+		var dim struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(r, &dim); err != nil {
+			return fmt.Errorf("dimension is neither a string nor an object: %s", string(r))
+		}
+		out = append(out, dim.Name)
+	}
+	*labels = out
+	return nil
+}
+
 // ToFieldList converts a LabelSet to a FieldList
 func (labels LabelSet) ToFieldList() FieldList {
 	fields := FieldList{}
@@ -70,28 +100,118 @@ func (labels LabelSet) ToDimensions() []string {
 	return dimensions
 }
 
-// ExtractUniqueLabels extracts unique labels from a Prometheus query  result.
-func ExtractUniqueLabels(result model.Value) (LabelSet, error) {
-	vec, ok := result.(model.Vector)
-	if !ok {
-		return nil, fmt.Errorf("query result is not a Vector")
+// Equal reports whether both LabelSets contain the same labels, regardless of
+// their order.
+func (labels LabelSet) Equal(other LabelSet) bool {
+	if len(labels) != len(other) {
+		return false
+	}
+	return len(missingFrom(labels, other)) == 0 && len(missingFrom(other, labels)) == 0
+}
+
+// Contains reports whether the label is part of the LabelSet.
+func (labels LabelSet) Contains(label string) bool {
+	for _, l := range labels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
+
+// Difference returns the labels that are not present in other.
+func (labels LabelSet) Difference(other LabelSet) LabelSet {
+	out := LabelSet{}
+	return append(out, missingFrom(labels, other)...)
+}
+
+// Union returns a LabelSet containing the labels of both LabelSets. Labels
+// only present in other are appended in their order.
+func (labels LabelSet) Union(other LabelSet) LabelSet {
+	out := make(LabelSet, 0, len(labels)+len(other))
+	out = append(out, labels...)
+	return append(out, missingFrom(other, labels)...)
+}
+
+// uniqueLabels collects label names in the order they are first seen.
+type uniqueLabels struct {
+	seen   map[string]bool
+	labels LabelSet
+}
+
+func newUniqueLabels() *uniqueLabels {
+	return &uniqueLabels{
+		seen:   make(map[string]bool),
+		labels: LabelSet{},
+	}
+}
+
+func (u *uniqueLabels) add(key string) {
+	// __name__ is thrown out
+	if key == "__name__" {
+		return
+	}
+	// If we haven't seen this label before, add it to the list.
+	if _, ok := u.seen[key]; !ok {
+		u.labels = append(u.labels, key)
+		u.seen[key] = true
 	}
+}
+
+// UnsupportedResultError is returned if a query result doesn't contain any
+// series to extract labels from, i.e. it is a scalar or a string.
+type UnsupportedResultError struct {
+	Type model.ValueType
+}
+
+func (e *UnsupportedResultError) Error() string {
+	return fmt.Sprintf("query result of type %s is not supported, expected a vector or matrix", e.Type)
+}
 
-	labelSeen := make(map[string]bool)
-	labels := LabelSet{}
-	for _, m := range vec {
-		for k := range m.Metric {
-			key := string(k)
-			// __name__ is thrown out
-			if key == "__name__" {
-				continue
+// ExtractUniqueLabels extracts unique labels from a Prometheus query  result.
+// The result of an instant query (Vector) as well as of a range query
+// (Matrix) is supported.
+func ExtractUniqueLabels(result model.Value) (LabelSet, error) {
+	u := newUniqueLabels()
+	switch v := result.(type) {
+	case model.Vector:
+		for _, m := range v {
+			for k := range m.Metric {
+				u.add(string(k))
 			}
-			// If we haven't seen this label before, add it to the list.
-			if _, ok := labelSeen[key]; !ok {
-				labels = append(labels, key)
-				labelSeen[key] = true
+		}
+	case model.Matrix:
+		for _, s := range v {
+			for k := range s.Metric {
+				u.add(string(k))
 			}
 		}
+	case nil:
+		return nil, &UnsupportedResultError{Type: model.ValNone}
+	default:
+		return nil, &UnsupportedResultError{Type: v.Type()}
+	}
+	return u.labels, nil
+}
+
+// ExtractUniqueLabelsFromSeries extracts unique labels from the result of the
+// Prometheus series API.
+func ExtractUniqueLabelsFromSeries(series []model.LabelSet) LabelSet {
+	u := newUniqueLabels()
+	for _, s := range series {
+		for k := range s {
+			u.add(string(k))
+		}
+	}
+	return u.labels
+}
+
+// LabelSetFromNames builds a LabelSet from the result of the Prometheus
+// labels API.
+func LabelSetFromNames(names []string) LabelSet {
+	u := newUniqueLabels()
+	for _, n := range names {
+		u.add(n)
 	}
-	return labels, nil
+	return u.labels
 }
@@ -17,6 +17,8 @@ limitations under the License.
 package ingestion
 
 import (
+	"encoding/json"
+	"errors"
 	"testing"
 
 	"github.com/prometheus/common/model"
@@ -39,6 +41,15 @@ func newSample(metric model.Metric, val float64, ts int64) *model.Sample {
 	}
 }
 
+func newSampleStream(metric model.Metric, ts int64) *model.SampleStream {
+	return &model.SampleStream{
+		Metric: metric,
+		Values: []model.SamplePair{
+			{Timestamp: model.Time(ts), Value: 0},
+		},
+	}
+}
+
 func TestExtractUniqueLabels(t *testing.T) {
 	var testData = []struct {
 		name     string
@@ -91,24 +102,42 @@ func TestExtractUniqueLabels(t *testing.T) {
 			expected: LabelSet{"foo", "test"},
 		},
 		{
-			name: "matrix as input",
-			in:   model.Matrix{},
-			errFn: func(err error) bool {
-				return err != nil && err.Error() == "query result is not a Vector"
+			name:     "empty matrix",
+			in:       model.Matrix{},
+			expected: LabelSet{},
+		},
+		{
+			name: "matrix with multiple series",
+			in: model.Matrix{
+				newSampleStream(newMetric("foo", "bar"), unixTimestamp),
+				newSampleStream(newMetric("__name__", "up"), unixTimestamp+1),
+				newSampleStream(newMetric("test", "test"), unixTimestamp+2),
 			},
+			expected: LabelSet{"foo", "test"},
 		},
 		{
 			name: "string as input",
 			in:   &model.String{},
 			errFn: func(err error) bool {
-				return err != nil && err.Error() == "query result is not a Vector"
+				var resultErr *UnsupportedResultError
+				return errors.As(err, &resultErr) && resultErr.Type == model.ValString &&
+					err.Error() == "query result of type string is not supported, expected a vector or matrix"
 			},
 		},
 		{
 			name: "scalar as input",
 			in:   &model.Scalar{},
 			errFn: func(err error) bool {
-				return err != nil && err.Error() == "query result is not a Vector"
+				var resultErr *UnsupportedResultError
+				return errors.As(err, &resultErr) && resultErr.Type == model.ValScalar
+			},
+		},
+		{
+			name: "nil as input",
+			in:   nil,
+			errFn: func(err error) bool {
+				var resultErr *UnsupportedResultError
+				return errors.As(err, &resultErr) && resultErr.Type == model.ValNone
 			},
 		},
 	}
@@ -125,6 +154,55 @@ func TestExtractUniqueLabels(t *testing.T) {
 	}
 }
 
+func TestExtractUniqueLabelsFromSeries(t *testing.T) {
+	var testData = []struct {
+		name     string
+		in       []model.LabelSet
+		expected LabelSet
+	}{
+		{
+			name:     "no series",
+			in:       []model.LabelSet{},
+			expected: LabelSet{},
+		},
+		{
+			name: "label __name__ should be thrown out",
+			in: []model.LabelSet{
+				{"__name__": "up", "foo": "bar"},
+			},
+			expected: LabelSet{"foo"},
+		},
+		{
+			name: "multiple series with same label name",
+			in: []model.LabelSet{
+				{"foo": "bar"},
+				{"foo": "baz"},
+			},
+			expected: LabelSet{"foo"},
+		},
+		{
+			name: "multiple series with different labels",
+			in: []model.LabelSet{
+				{"foo": "bar"},
+				{"test": "test"},
+			},
+			expected: LabelSet{"foo", "test"},
+		},
+	}
+
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			actual := ExtractUniqueLabelsFromSeries(test.in)
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestLabelSetFromNames(t *testing.T) {
+	assert.Equal(t, LabelSet{}, LabelSetFromNames(nil))
+	assert.Equal(t, LabelSet{"foo", "test"}, LabelSetFromNames([]string{"__name__", "foo", "test", "foo"}))
+}
+
 func TestLabelSetToFields(t *testing.T) {
 	var testData = []struct {
 		name     string
@@ -223,3 +301,91 @@ func TestLabelSetToDimensions(t *testing.T) {
 		})
 	}
 }
+
+func TestLabelSetUnmarshalJSON(t *testing.T) {
+	var testData = []struct {
+		name     string
+		in       string
+		expected LabelSet
+		err      bool
+	}{
+		{
+			name:     "strings",
+			in:       `["name", "foo"]`,
+			expected: LabelSet{"name", "foo"},
+		},
+		{
+			name:     "dimension objects",
+			in:       `[{"type": "string", "name": "name", "createBitmapIndex": true}, "foo"]`,
+			expected: LabelSet{"name", "foo"},
+		},
+		{
+			name:     "empty",
+			in:       `[]`,
+			expected: LabelSet{},
+		},
+		{
+			name: "invalid dimension",
+			in:   `[1]`,
+			err:  true,
+		},
+	}
+
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			var actual LabelSet
+			err := json.Unmarshal([]byte(test.in), &actual)
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestLabelSetEqual(t *testing.T) {
+	var testData = []struct {
+		name     string
+		a, b     LabelSet
+		expected bool
+	}{
+		{name: "both empty", a: LabelSet{}, b: nil, expected: true},
+		{name: "same order", a: LabelSet{"foo", "bar"}, b: LabelSet{"foo", "bar"}, expected: true},
+		{name: "different order", a: LabelSet{"foo", "bar"}, b: LabelSet{"bar", "foo"}, expected: true},
+		{name: "different labels", a: LabelSet{"foo", "bar"}, b: LabelSet{"foo", "baz"}, expected: false},
+		{name: "different length", a: LabelSet{"foo"}, b: LabelSet{"foo", "bar"}, expected: false},
+	}
+
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, test.a.Equal(test.b))
+			assert.Equal(t, test.expected, test.b.Equal(test.a))
+		})
+	}
+}
+
+func TestLabelSetDifference(t *testing.T) {
+	assert.Equal(t, LabelSet{}, LabelSet(nil).Difference(LabelSet{"foo"}))
+	assert.Equal(t, LabelSet{"bar"}, LabelSet{"foo", "bar"}.Difference(LabelSet{"foo", "baz"}))
+	assert.Equal(t, LabelSet{"foo", "bar"}, LabelSet{"foo", "bar"}.Difference(nil))
+}
+
+func TestLabelSetUnion(t *testing.T) {
+	var testData = []struct {
+		name     string
+		a, b     LabelSet
+		expected LabelSet
+	}{
+		{name: "both empty", a: nil, b: nil, expected: LabelSet{}},
+		{name: "disjoint", a: LabelSet{"foo"}, b: LabelSet{"bar"}, expected: LabelSet{"foo", "bar"}},
+		{name: "overlapping", a: LabelSet{"foo", "bar"}, b: LabelSet{"baz", "foo"}, expected: LabelSet{"foo", "bar", "baz"}},
+	}
+
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, test.a.Union(test.b))
+		})
+	}
+}
@@ -0,0 +1,270 @@
+/*
+Copyright 2020 noris network AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingestion
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MetricType is the type of a Prometheus metric family, as returned by the
+// Prometheus metadata API.
+type MetricType string
+
+// Metric types returned by the Prometheus metadata API.
+const (
+	MetricTypeCounter        MetricType = "counter"
+	MetricTypeGauge          MetricType = "gauge"
+	MetricTypeHistogram      MetricType = "histogram"
+	MetricTypeGaugeHistogram MetricType = "gaugehistogram"
+	MetricTypeSummary        MetricType = "summary"
+	MetricTypeUnknown        MetricType = "unknown"
+)
+
+// MetricTypes maps the names of metrics, as stored in the 'name' column, to
+// the type of their samples. Series of histograms and summaries are resolved
+// to counters and gauges, see ResolveMetricTypes.
+type MetricTypes map[string]MetricType
+
+// ResolveMetricTypes looks up the types of the metric names in the types of
+// the metric families. The '_bucket', '_sum' and '_count' series of
+// histograms and the '_sum' and '_count' series of summaries are counters,
+// the quantiles of summaries and the series of gauge histograms are gauges.
+// Names without a known type are left out.
+func ResolveMetricTypes(names []string, families map[string]MetricType) MetricTypes {
+	types := MetricTypes{}
+	for _, name := range names {
+		if t, ok := families[name]; ok {
+			switch t {
+			case MetricTypeCounter:
+				types[name] = MetricTypeCounter
+			case MetricTypeGauge, MetricTypeSummary:
+				types[name] = MetricTypeGauge
+			}
+			continue
+		}
+		for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+			if !strings.HasSuffix(name, suffix) {
+				continue
+			}
+			switch families[strings.TrimSuffix(name, suffix)] {
+			case MetricTypeHistogram:
+				types[name] = MetricTypeCounter
+			case MetricTypeSummary:
+				if suffix != "_bucket" {
+					types[name] = MetricTypeCounter
+				}
+			case MetricTypeGaugeHistogram:
+				types[name] = MetricTypeGauge
+			}
+		}
+	}
+	return types
+}
+
+// names returns the sorted metric names of the given type.
+func (types MetricTypes) names(t MetricType) []string {
+	var names []string
+	for name, typ := range types {
+		if typ == t {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// filteredMetric returns an aggregator that only aggregates the values of the
+// given metric names.
+func filteredMetric(names []string, aggregator Metric) Metric {
+	return Metric{
+		Name: aggregator.Name,
+		Type: "filtered",
+		Filter: &Filter{
+			Type:      "in",
+			Dimension: "name",
+			Values:    names,
+		},
+		Aggregator: &aggregator,
+	}
+}
+
+// SetMetricTypes adds aggregators suited to the type of each metric to the
+// metrics of the spec. As all metrics share the 'value' column, the
+// aggregators are filtered by the 'name' column:
+//
+// Counters only increase, so within a rollup interval their maximum is their
+// last value ('counter_max'), unless they were reset in between. The value
+// with the latest timestamp is kept as well ('counter_last'); numeric last
+// aggregators need Druid 28 or later at ingestion time. For gauges the minimum, maximum, sum and count
+// are kept, so averages can be computed at query time ('gauge_min',
+// 'gauge_max', 'gauge_sum' and 'gauge_count').
+func SetMetricTypes(types MetricTypes) KafkaIngestionSpecOptions {
+	return func(spec *KafkaIngestionSpec) {
+		metrics := spec.DataSchema.MetricsSpec
+		if counters := types.names(MetricTypeCounter); len(counters) > 0 {
+			metrics = append(metrics,
+				filteredMetric(counters, Metric{Name: "counter_max", Type: "doubleMax", FieldName: "value"}),
+				filteredMetric(counters, Metric{Name: "counter_last", Type: "doubleLast", FieldName: "value"}),
+			)
+		}
+		if gauges := types.names(MetricTypeGauge); len(gauges) > 0 {
+			metrics = append(metrics,
+				filteredMetric(gauges, Metric{Name: "gauge_min", Type: "doubleMin", FieldName: "value"}),
+				filteredMetric(gauges, Metric{Name: "gauge_max", Type: "doubleMax", FieldName: "value"}),
+				filteredMetric(gauges, Metric{Name: "gauge_sum", Type: "doubleSum", FieldName: "value"}),
+				filteredMetric(gauges, Metric{Name: "gauge_count", Type: "count"}),
+			)
+		}
+		spec.DataSchema.MetricsSpec = metrics
+	}
+}
+
+// aggregatorTypes are the Druid aggregators that can be used at ingestion
+// time. The value tells whether the aggregator reads a field.
+var aggregatorTypes = map[string]bool{
+	"count":       false,
+	"longSum":     true,
+	"doubleSum":   true,
+	"floatSum":    true,
+	"longMin":     true,
+	"doubleMin":   true,
+	"floatMin":    true,
+	"longMax":     true,
+	"doubleMax":   true,
+	"floatMax":    true,
+	"longFirst":   true,
+	"doubleFirst": true,
+	"floatFirst":  true,
+	"longLast":    true,
+	"doubleLast":  true,
+	"floatLast":   true,
+	"stringFirst": true,
+	"stringLast":  true,
+	"hyperUnique": true,
+	"filtered":    false,
+
+	quantilesSketchType:     true,
+	string(SketchTypeHLL):   true,
+	string(SketchTypeTheta): true,
+}
+
+// ParseMetric parses a metric given as 'name:type[:field]', e.g.
+// 'value_sum:doubleSum'. If no field is given, aggregators reading a field
+// read 'value'.
+func ParseMetric(s string) (Metric, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return Metric{}, fmt.Errorf("invalid metric %q, expected name:type[:field]", s)
+	}
+	m := Metric{Name: parts[0], Type: parts[1]}
+	readsField, ok := aggregatorTypes[m.Type]
+	if !ok {
+		return Metric{}, fmt.Errorf("unknown aggregator type %q", m.Type)
+	}
+	switch {
+	case len(parts) == 3 && !readsField:
+		return Metric{}, fmt.Errorf("aggregator type %q doesn't read a field", m.Type)
+	case len(parts) == 3:
+		m.FieldName = parts[2]
+	case readsField:
+		m.FieldName = "value"
+	}
+	return m, nil
+}
+
+// inputFields returns the fields of the input rows that metrics can read:
+// the flatten fields and the root fields of prometheus-kafka-adapter, which
+// Druid discovers on its own.
+func (spec *KafkaIngestionSpec) inputFields() map[string]bool {
+	fields := map[string]bool{
+		"name":                      true,
+		"value":                     true,
+		spec.timestampSpec().Column: true,
+	}
+	for _, f := range spec.flattenSpec().Fields {
+		fields[f.Name] = true
+	}
+	return fields
+}
+
+// validateMetrics checks the aggregator types and sizes of the metrics.
+func (spec *KafkaIngestionSpec) validateMetrics() error {
+	var validate func(m Metric) error
+	validate = func(m Metric) error {
+		if m.Name == "" {
+			return errors.New("metric without name")
+		}
+		if _, ok := aggregatorTypes[m.Type]; !ok {
+			return fmt.Errorf("metric %q: unknown aggregator type %q", m.Name, m.Type)
+		}
+		if err := validateSketchSize(m); err != nil {
+			return fmt.Errorf("metric %q: %w", m.Name, err)
+		}
+		if m.Type == "filtered" {
+			if m.Filter == nil || m.Aggregator == nil {
+				return fmt.Errorf("metric %q: filtered aggregator needs a filter and an aggregator", m.Name)
+			}
+			return validate(*m.Aggregator)
+		}
+		return nil
+	}
+	for _, m := range spec.DataSchema.MetricsSpec {
+		if err := validate(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateMetricFields checks that the metrics only read fields of the input
+// rows. It expects valid metrics, see validateMetrics.
+func (spec *KafkaIngestionSpec) validateMetricFields() error {
+	fields := spec.inputFields()
+	var validate func(m Metric) error
+	validate = func(m Metric) error {
+		if aggregatorTypes[m.Type] && !fields[m.FieldName] {
+			return &UnknownColumnError{Context: fmt.Sprintf("metric %q", m.Name), Column: m.FieldName}
+		}
+		if m.Type == "filtered" {
+			return validate(*m.Aggregator)
+		}
+		return nil
+	}
+	for _, m := range spec.DataSchema.MetricsSpec {
+		if err := validate(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetMetrics replaces the metrics of the spec.
+func SetMetrics(metrics ...Metric) KafkaIngestionSpecOptions {
+	return func(spec *KafkaIngestionSpec) {
+		spec.DataSchema.MetricsSpec = append([]Metric{}, metrics...)
+	}
+}
+
+// AddMetrics adds metrics to the metrics of the spec.
+func AddMetrics(metrics ...Metric) KafkaIngestionSpecOptions {
+	return func(spec *KafkaIngestionSpec) {
+		spec.DataSchema.MetricsSpec = append(spec.DataSchema.MetricsSpec, metrics...)
+	}
+}
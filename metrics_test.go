@@ -0,0 +1,206 @@
+/*
+Copyright 2020 noris network AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingestion
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveMetricTypes(t *testing.T) {
+	families := map[string]MetricType{
+		"http_requests_total":           MetricTypeCounter,
+		"up":                            MetricTypeGauge,
+		"http_request_duration_seconds": MetricTypeHistogram,
+		"rpc_duration_seconds":          MetricTypeSummary,
+		"queue_size":                    MetricTypeGaugeHistogram,
+		"something":                     MetricTypeUnknown,
+	}
+	names := []string{
+		"http_requests_total",
+		"up",
+		"http_request_duration_seconds_bucket",
+		"http_request_duration_seconds_sum",
+		"http_request_duration_seconds_count",
+		"rpc_duration_seconds",
+		"rpc_duration_seconds_sum",
+		"rpc_duration_seconds_count",
+		"queue_size_bucket",
+		"something",
+		"job:up:sum",
+	}
+	assert.Equal(t, MetricTypes{
+		"http_requests_total":                  MetricTypeCounter,
+		"up":                                   MetricTypeGauge,
+		"http_request_duration_seconds_bucket": MetricTypeCounter,
+		"http_request_duration_seconds_sum":    MetricTypeCounter,
+		"http_request_duration_seconds_count":  MetricTypeCounter,
+		"rpc_duration_seconds":                 MetricTypeGauge,
+		"rpc_duration_seconds_sum":             MetricTypeCounter,
+		"rpc_duration_seconds_count":           MetricTypeCounter,
+		"queue_size_bucket":                    MetricTypeGauge,
+	}, ResolveMetricTypes(names, families))
+}
+
+func TestSetMetricTypes(t *testing.T) {
+	spec := NewKafkaIngestionSpec(SetMetricTypes(MetricTypes{
+		"up":                  MetricTypeGauge,
+		"http_requests_total": MetricTypeCounter,
+		"rpc_duration_sum":    MetricTypeCounter,
+	}))
+	assert.NoError(t, spec.Validate())
+	actual, err := json.MarshalIndent(spec.DataSchema.MetricsSpec[:4], "", "    ")
+	assert.NoError(t, err)
+	assert.Equal(t, `[
+    {
+        "name": "count",
+        "type": "count"
+    },
+    {
+        "name": "value",
+        "type": "doubleMax",
+        "fieldName": "value"
+    },
+    {
+        "name": "counter_max",
+        "type": "filtered",
+        "filter": {
+            "type": "in",
+            "dimension": "name",
+            "values": [
+                "http_requests_total",
+                "rpc_duration_sum"
+            ]
+        },
+        "aggregator": {
+            "name": "counter_max",
+            "type": "doubleMax",
+            "fieldName": "value"
+        }
+    },
+    {
+        "name": "counter_last",
+        "type": "filtered",
+        "filter": {
+            "type": "in",
+            "dimension": "name",
+            "values": [
+                "http_requests_total",
+                "rpc_duration_sum"
+            ]
+        },
+        "aggregator": {
+            "name": "counter_last",
+            "type": "doubleLast",
+            "fieldName": "value"
+        }
+    }
+]`, string(actual))
+	assert.Len(t, spec.DataSchema.MetricsSpec, 8)
+	assert.Equal(t, "gauge_min", spec.DataSchema.MetricsSpec[4].Name)
+
+	assert.Equal(t, defaultKafkaIngestionSpec().DataSchema.MetricsSpec,
+		NewKafkaIngestionSpec(SetMetricTypes(MetricTypes{})).DataSchema.MetricsSpec)
+}
+
+func TestParseMetric(t *testing.T) {
+	var testData = []struct {
+		in       string
+		expected Metric
+		err      bool
+	}{
+		{in: "value_sum:doubleSum", expected: Metric{Name: "value_sum", Type: "doubleSum", FieldName: "value"}},
+		{in: "value_last:doubleLast:value", expected: Metric{Name: "value_last", Type: "doubleLast", FieldName: "value"}},
+		{in: "job_last:stringLast:job", expected: Metric{Name: "job_last", Type: "stringLast", FieldName: "job"}},
+		{in: "rows:count", expected: Metric{Name: "rows", Type: "count"}},
+		{in: "rows:count:value", err: true},
+		{in: "value_sum", err: true},
+		{in: ":doubleSum", err: true},
+		{in: "value_sum:sum", err: true},
+		{in: "a:doubleSum:value:b", err: true},
+	}
+
+	for _, test := range testData {
+		t.Run(test.in, func(t *testing.T) {
+			actual, err := ParseMetric(test.in)
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestSetMetrics(t *testing.T) {
+	spec := NewKafkaIngestionSpec(
+		SetMetrics(Metric{Name: "count", Type: "count"}),
+		AddMetrics(Metric{Name: "value_sum", Type: "doubleSum", FieldName: "value"}),
+		SetMetricTypes(MetricTypes{"up": MetricTypeCounter}),
+	)
+	assert.NoError(t, spec.Validate())
+	assert.Equal(t, []Metric{
+		{Name: "count", Type: "count"},
+		{Name: "value_sum", Type: "doubleSum", FieldName: "value"},
+		filteredMetric([]string{"up"}, Metric{Name: "counter_max", Type: "doubleMax", FieldName: "value"}),
+		filteredMetric([]string{"up"}, Metric{Name: "counter_last", Type: "doubleLast", FieldName: "value"}),
+	}, spec.DataSchema.MetricsSpec)
+}
+
+func TestKafkaIngestionSpec_ValidateMetrics(t *testing.T) {
+	var testData = []struct {
+		name    string
+		options []KafkaIngestionSpecOptions
+		err     bool
+	}{
+		{
+			name:    "label field",
+			options: []KafkaIngestionSpecOptions{SetLabels(LabelSet{"job"}), AddMetrics(Metric{Name: "job_last", Type: "stringLast", FieldName: "job"})},
+		},
+		{
+			name:    "unknown field",
+			options: []KafkaIngestionSpecOptions{AddMetrics(Metric{Name: "job_last", Type: "stringLast", FieldName: "job"})},
+			err:     true,
+		},
+		{
+			name:    "unknown type",
+			options: []KafkaIngestionSpecOptions{AddMetrics(Metric{Name: "value_sum", Type: "sum", FieldName: "value"})},
+			err:     true,
+		},
+		{
+			name: "invalid filtered aggregator",
+			options: []KafkaIngestionSpecOptions{AddMetrics(
+				filteredMetric([]string{"up"}, Metric{Name: "up_sum", Type: "doubleSum", FieldName: "foo"}),
+			)},
+			err: true,
+		},
+	}
+
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			err := NewKafkaIngestionSpec(test.options...).Validate()
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
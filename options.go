@@ -23,24 +23,27 @@ func stringPointer(s string) *string {
 	return &s
 }
 
+func intPointer(i int) *int {
+	return &i
+}
+
+func boolPointer(b bool) *bool {
+	return &b
+}
+
+// tuningConfig returns the TuningConfig of the spec and creates it if it
+// doesn't exist yet.
+func (spec *KafkaIngestionSpec) tuningConfig() *TuningConfig {
+	if spec.TuningConfig == nil {
+		spec.TuningConfig = &TuningConfig{Type: "kafka"}
+	}
+	return spec.TuningConfig
+}
+
 // ApplySSLConfig adds an opinionated SSL config that is used for communicating
-// with Kafka securely.
+// with Kafka securely. See DefaultSSLConfig.
 func ApplySSLConfig() KafkaIngestionSpecOptions {
-	return func(spec *KafkaIngestionSpec) {
-		spec.IOConfig.ConsumerProperties.SecurityProtocol = stringPointer("SSL")
-		spec.IOConfig.ConsumerProperties.SSLTruststoreType = stringPointer("PKCS12")
-		spec.IOConfig.ConsumerProperties.SSLEnabledProtocols = stringPointer("TLSv1.2")
-		spec.IOConfig.ConsumerProperties.SSLTruststoreLocation = stringPointer("/var/private/ssl/truststore.p12")
-		spec.IOConfig.ConsumerProperties.SSLTruststorePassword = &PasswordProvider{
-			Type:     "environment",
-			Variable: "DRUID_TRUSTSTORE_PASSWORD",
-		}
-		spec.IOConfig.ConsumerProperties.SSLKeystoreLocation = stringPointer("/var/private/ssl/keystore.p12")
-		spec.IOConfig.ConsumerProperties.SSLKeystorePassword = &PasswordProvider{
-			Type:     "environment",
-			Variable: "DRUID_KEYSTORE_PASSWORD",
-		}
-	}
+	return SetSSLConfig(DefaultSSLConfig())
 }
 
 // SetDataSource sets the name of the dataSource used in Druid.
@@ -54,6 +57,7 @@ func SetDataSource(ds string) KafkaIngestionSpecOptions {
 func SetTopic(topic string) KafkaIngestionSpecOptions {
 	return func(spec *KafkaIngestionSpec) {
 		spec.IOConfig.Topic = topic
+		spec.IOConfig.TopicPattern = nil
 	}
 }
 
@@ -69,7 +73,63 @@ func SetBrokers(brokers string) KafkaIngestionSpecOptions {
 // This sets the FieldList under FlattenSpec, as well as Dimensions.
 func SetLabels(labels LabelSet) KafkaIngestionSpecOptions {
 	return func(spec *KafkaIngestionSpec) {
-		spec.DataSchema.Parser.ParseSpec.FlattenSpec.Fields = labels.ToFieldList()
-		spec.DataSchema.Parser.ParseSpec.DimensionsSpec.Dimensions = labels.ToDimensions()
+		spec.flattenSpec().Fields = labels.ToFieldList()
+		spec.dimensionsSpec().Dimensions = labels.ToDimensions()
+	}
+}
+
+// SetSpecMode switches the layout of the spec between the legacy parser and
+// the inputFormat based spec. Options can be applied before or after it.
+func SetSpecMode(mode SpecMode) KafkaIngestionSpecOptions {
+	return func(spec *KafkaIngestionSpec) {
+		spec.setMode(mode)
+	}
+}
+
+// SetTuningConfig replaces the TuningConfig of the spec. If no type is set,
+// 'kafka' is used.
+func SetTuningConfig(tc TuningConfig) KafkaIngestionSpecOptions {
+	return func(spec *KafkaIngestionSpec) {
+		if tc.Type == "" {
+			tc.Type = "kafka"
+		}
+		spec.TuningConfig = &tc
+	}
+}
+
+// SetMaxRowsInMemory sets the number of rows to aggregate before persisting.
+func SetMaxRowsInMemory(rows int) KafkaIngestionSpecOptions {
+	return func(spec *KafkaIngestionSpec) {
+		spec.tuningConfig().MaxRowsInMemory = intPointer(rows)
+	}
+}
+
+// SetMaxRowsPerSegment sets the number of rows to aggregate into a segment.
+func SetMaxRowsPerSegment(rows int) KafkaIngestionSpecOptions {
+	return func(spec *KafkaIngestionSpec) {
+		spec.tuningConfig().MaxRowsPerSegment = intPointer(rows)
+	}
+}
+
+// SetIntermediatePersistPeriod sets the ISO-8601 period that determines the
+// rate at which intermediate persists occur. E.g. 'PT10M'.
+func SetIntermediatePersistPeriod(period string) KafkaIngestionSpecOptions {
+	return func(spec *KafkaIngestionSpec) {
+		spec.tuningConfig().IntermediatePersistPeriod = stringPointer(period)
+	}
+}
+
+// SetIndexSpec sets the IndexSpec used for indexing segments.
+func SetIndexSpec(indexSpec IndexSpec) KafkaIngestionSpecOptions {
+	return func(spec *KafkaIngestionSpec) {
+		spec.tuningConfig().IndexSpec = &indexSpec
+	}
+}
+
+// SetResetOffsetAutomatically configures whether Druid resets the consumer
+// offset when the next offset to fetch is not available anymore.
+func SetResetOffsetAutomatically(reset bool) KafkaIngestionSpecOptions {
+	return func(spec *KafkaIngestionSpec) {
+		spec.tuningConfig().ResetOffsetAutomatically = boolPointer(reset)
 	}
 }
@@ -0,0 +1,184 @@
+/*
+Copyright 2020 noris network AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingestion
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const supervisorPath = "/druid/indexer/v1/supervisor"
+
+// OverlordClient talks to the supervisor API of a Druid Overlord.
+type OverlordClient struct {
+	address    string
+	username   string
+	password   string
+	tlsConfig  *tls.Config
+	httpClient *http.Client
+}
+
+// OverlordClientOptions allows for configuring an OverlordClient.
+type OverlordClientOptions func(*OverlordClient)
+
+// SetBasicAuth configures the OverlordClient to authenticate with HTTP basic
+// auth.
+func SetBasicAuth(username, password string) OverlordClientOptions {
+	return func(c *OverlordClient) {
+		c.username = username
+		c.password = password
+	}
+}
+
+// SetRootCAs sets the certificate authorities used to verify the Overlord's
+// certificate.
+func SetRootCAs(pool *x509.CertPool) OverlordClientOptions {
+	return func(c *OverlordClient) {
+		c.tlsConfig.RootCAs = pool
+	}
+}
+
+// SetInsecureSkipVerify disables the verification of the Overlord's
+// certificate.
+func SetInsecureSkipVerify(skip bool) OverlordClientOptions {
+	return func(c *OverlordClient) {
+		c.tlsConfig.InsecureSkipVerify = skip
+	}
+}
+
+// SetTimeout sets the timeout for requests against the Overlord.
+func SetTimeout(timeout time.Duration) OverlordClientOptions {
+	return func(c *OverlordClient) {
+		c.httpClient.Timeout = timeout
+	}
+}
+
+// NewOverlordClient returns an OverlordClient for the Overlord running at
+// address, e.g. 'https://druid-overlord:8281', and applies any options passed
+// to it.
+func NewOverlordClient(address string, options ...OverlordClientOptions) *OverlordClient {
+	c := &OverlordClient{
+		address:   strings.TrimSuffix(address, "/"),
+		tlsConfig: &tls.Config{},
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+	for _, fn := range options {
+		fn(c)
+	}
+	c.httpClient.Transport = &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: c.tlsConfig,
+	}
+	return c
+}
+
+// OverlordError is returned if the Overlord responds with a non-2xx status
+// code. Body contains the error returned by Druid.
+type OverlordError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *OverlordError) Error() string {
+	return fmt.Sprintf("overlord returned %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Body)
+}
+
+// SubmitSupervisor creates or updates the supervisor for the spec's dataSource
+// and returns the id of the supervisor.
+func (c *OverlordClient) SubmitSupervisor(ctx context.Context, spec *KafkaIngestionSpec) (string, error) {
+	body, err := json.Marshal(spec)
+	if err != nil {
+		return "", fmt.Errorf("marshalling ingestion spec: %w", err)
+	}
+	var resp struct {
+		ID string `json:"id"`
+	}
+	if err := c.do(ctx, http.MethodPost, supervisorPath, body, &resp); err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+// GetSupervisor returns the spec of the running supervisor with the given id.
+// If the supervisor doesn't exist, an OverlordError with status 404 is
+// returned.
+func (c *OverlordClient) GetSupervisor(ctx context.Context, id string) (*KafkaIngestionSpec, error) {
+	// Depending on the Druid version the spec is returned at the root level,
+	// under 'spec' or both.
+	var resp struct {
+		KafkaIngestionSpec
+		Spec *KafkaIngestionSpec `json:"spec"`
+	}
+	if err := c.do(ctx, http.MethodGet, supervisorPath+"/"+url.PathEscape(id), nil, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Spec != nil {
+		return resp.Spec, nil
+	}
+	return &resp.KafkaIngestionSpec, nil
+}
+
+// do sends a request to the Overlord and decodes the JSON response into out.
+func (c *OverlordClient) do(ctx context.Context, method, path string, body []byte, out interface{}) error {
+	req, err := http.NewRequest(method, c.address+path, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.username != "" || c.password != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("sending request to overlord: %w", err)
+	}
+	defer res.Body.Close()
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("reading overlord response: %w", err)
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return &OverlordError{
+			StatusCode: res.StatusCode,
+			Body:       strings.TrimSpace(string(b)),
+		}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(b, out); err != nil {
+		return fmt.Errorf("decoding overlord response: %w", err)
+	}
+	return nil
+}
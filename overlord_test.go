@@ -0,0 +1,198 @@
+/*
+Copyright 2020 noris network AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingestion
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeOverlord is a minimal Druid Overlord that stores submitted supervisor
+// specs by dataSource.
+type fakeOverlord struct {
+	username    string
+	password    string
+	supervisors map[string]*KafkaIngestionSpec
+}
+
+func newFakeOverlord() *fakeOverlord {
+	return &fakeOverlord{
+		supervisors: make(map[string]*KafkaIngestionSpec),
+	}
+}
+
+func (o *fakeOverlord) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if o.username != "" {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != o.username || pass != o.password {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}
+	if r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, supervisorPath+"/") {
+		spec, ok := o.supervisors[strings.TrimPrefix(r.URL.Path, supervisorPath+"/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		// Druid returns the spec both at the root level and under 'spec'.
+		json.NewEncoder(w).Encode(struct {
+			*KafkaIngestionSpec
+			Spec      *KafkaIngestionSpec `json:"spec"`
+			Suspended bool                `json:"suspended"`
+		}{spec, spec, false})
+		return
+	}
+	if r.URL.Path != supervisorPath || r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if r.Header.Get("Content-Type") != "application/json" {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+	var spec *KafkaIngestionSpec
+	if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error":%q}`, err.Error())
+		return
+	}
+	if spec.DataSchema.DataSource == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"error":"dataSource cannot be null or empty"}`)
+		return
+	}
+	o.supervisors[spec.DataSchema.DataSource] = spec
+	fmt.Fprintf(w, `{"id":%q}`, spec.DataSchema.DataSource)
+}
+
+func TestOverlordClient_SubmitSupervisor(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		overlord := newFakeOverlord()
+		srv := httptest.NewServer(overlord)
+		defer srv.Close()
+
+		spec := NewKafkaIngestionSpec(SetDataSource("test"))
+		id, err := NewOverlordClient(srv.URL+"/").SubmitSupervisor(context.Background(), spec)
+		assert.NoError(t, err)
+		assert.Equal(t, "test", id)
+		assert.Equal(t, spec, overlord.supervisors["test"])
+	})
+
+	t.Run("druid error", func(t *testing.T) {
+		srv := httptest.NewServer(newFakeOverlord())
+		defer srv.Close()
+
+		spec := NewKafkaIngestionSpec(SetDataSource(""))
+		_, err := NewOverlordClient(srv.URL).SubmitSupervisor(context.Background(), spec)
+		var overlordErr *OverlordError
+		if assert.True(t, errors.As(err, &overlordErr)) {
+			assert.Equal(t, http.StatusBadRequest, overlordErr.StatusCode)
+			assert.Equal(t, `{"error":"dataSource cannot be null or empty"}`, overlordErr.Body)
+		}
+	})
+
+	t.Run("basic auth", func(t *testing.T) {
+		overlord := newFakeOverlord()
+		overlord.username = "druid"
+		overlord.password = "secret"
+		srv := httptest.NewServer(overlord)
+		defer srv.Close()
+
+		spec := NewKafkaIngestionSpec()
+		_, err := NewOverlordClient(srv.URL).SubmitSupervisor(context.Background(), spec)
+		var overlordErr *OverlordError
+		if assert.True(t, errors.As(err, &overlordErr)) {
+			assert.Equal(t, http.StatusUnauthorized, overlordErr.StatusCode)
+		}
+
+		id, err := NewOverlordClient(srv.URL, SetBasicAuth("druid", "secret")).SubmitSupervisor(context.Background(), spec)
+		assert.NoError(t, err)
+		assert.Equal(t, "prometheus", id)
+	})
+
+	t.Run("custom CA", func(t *testing.T) {
+		srv := httptest.NewTLSServer(newFakeOverlord())
+		defer srv.Close()
+
+		spec := NewKafkaIngestionSpec()
+		_, err := NewOverlordClient(srv.URL).SubmitSupervisor(context.Background(), spec)
+		assert.Error(t, err)
+
+		pool := x509.NewCertPool()
+		pool.AddCert(srv.Certificate())
+		id, err := NewOverlordClient(srv.URL, SetRootCAs(pool)).SubmitSupervisor(context.Background(), spec)
+		assert.NoError(t, err)
+		assert.Equal(t, "prometheus", id)
+	})
+}
+
+func TestOverlordClient_GetSupervisor(t *testing.T) {
+	t.Run("existing supervisor", func(t *testing.T) {
+		overlord := newFakeOverlord()
+		srv := httptest.NewServer(overlord)
+		defer srv.Close()
+
+		spec := NewKafkaIngestionSpec(SetLabels(LabelSet{"foo"}))
+		overlord.supervisors["prometheus"] = spec
+		actual, err := NewOverlordClient(srv.URL).GetSupervisor(context.Background(), "prometheus")
+		assert.NoError(t, err)
+		assert.Equal(t, spec, actual)
+	})
+
+	t.Run("missing supervisor", func(t *testing.T) {
+		srv := httptest.NewServer(newFakeOverlord())
+		defer srv.Close()
+
+		_, err := NewOverlordClient(srv.URL).GetSupervisor(context.Background(), "prometheus")
+		var overlordErr *OverlordError
+		if assert.True(t, errors.As(err, &overlordErr)) {
+			assert.Equal(t, http.StatusNotFound, overlordErr.StatusCode)
+		}
+	})
+
+	t.Run("spec only nested", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"type":"kafka","spec":{"type":"kafka","dataSchema":{"dataSource":"test"}}}`)
+		}))
+		defer srv.Close()
+
+		actual, err := NewOverlordClient(srv.URL).GetSupervisor(context.Background(), "test")
+		assert.NoError(t, err)
+		assert.Equal(t, "test", actual.DataSchema.DataSource)
+	})
+
+	t.Run("spec only at root level", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"type":"kafka","dataSchema":{"dataSource":"test"}}`)
+		}))
+		defer srv.Close()
+
+		actual, err := NewOverlordClient(srv.URL).GetSupervisor(context.Background(), "test")
+		assert.NoError(t, err)
+		assert.Equal(t, "test", actual.DataSchema.DataSource)
+	})
+}
@@ -0,0 +1,205 @@
+/*
+Copyright 2020 noris network AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingestion
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ParseJavaProperties parses a Java properties file, like the
+// client.properties files used to configure Kafka clients.
+func ParseJavaProperties(r io.Reader) (map[string]string, error) {
+	props := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	var logical strings.Builder
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimLeft(scanner.Text(), " \t\f")
+		if logical.Len() == 0 && (line == "" || line[0] == '#' || line[0] == '!') {
+			continue
+		}
+		// A line ending with an odd number of backslashes continues on the
+		// next line.
+		if continues(line) {
+			logical.WriteString(line[:len(line)-1])
+			continue
+		}
+		logical.WriteString(line)
+		key, value, err := splitProperty(logical.String())
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		props[key] = value
+		logical.Reset()
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if logical.Len() > 0 {
+		key, value, err := splitProperty(logical.String())
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		props[key] = value
+	}
+	return props, nil
+}
+
+func continues(line string) bool {
+	n := 0
+	for i := len(line) - 1; i >= 0 && line[i] == '\\'; i-- {
+		n++
+	}
+	return n%2 == 1
+}
+
+// splitProperty splits a logical line into its unescaped key and value. The
+// key ends at the first unescaped '=', ':' or whitespace.
+func splitProperty(line string) (string, string, error) {
+	end := len(line)
+	for i := 0; i < len(line); i++ {
+		if line[i] == '\\' {
+			i++
+			continue
+		}
+		if strings.IndexByte("=: \t\f", line[i]) >= 0 {
+			end = i
+			break
+		}
+	}
+	rest := strings.TrimLeft(line[end:], " \t\f")
+	if rest != "" && (rest[0] == '=' || rest[0] == ':') {
+		rest = strings.TrimLeft(rest[1:], " \t\f")
+	}
+	key, err := unescapeProperty(line[:end])
+	if err != nil {
+		return "", "", err
+	}
+	value, err := unescapeProperty(rest)
+	if err != nil {
+		return "", "", err
+	}
+	return key, value, nil
+}
+
+func unescapeProperty(s string) (string, error) {
+	if !strings.Contains(s, "\\") {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i == len(s)-1 {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 'f':
+			b.WriteByte('\f')
+		case 'u':
+			if i+4 >= len(s) {
+				return "", fmt.Errorf("malformed \\u escape in %q", s)
+			}
+			r, err := strconv.ParseUint(s[i+1:i+5], 16, 16)
+			if err != nil {
+				return "", fmt.Errorf("malformed \\u escape in %q", s)
+			}
+			b.WriteRune(rune(r))
+			i += 4
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String(), nil
+}
+
+// ClientPropertyVariable returns the environment variable a secret client
+// property is read from by Druid, e.g. 'DRUID_KAFKA_SSL_KEYSTORE_PASSWORD'
+// for 'ssl.keystore.password' and the prefix 'DRUID_KAFKA_'.
+func ClientPropertyVariable(prefix, key string) string {
+	return prefix + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(key))
+}
+
+// IsSecretClientProperty reports whether the client property holds a secret
+// that must not be written into the spec, i.e. a password or JAAS config.
+func IsSecretClientProperty(key string) bool {
+	return strings.Contains(key, "password") || strings.Contains(key, "jaas") || strings.Contains(key, "secret")
+}
+
+// SetClientProperties maps the properties of a Java Kafka client to the
+// consumer properties. Properties modeled by KafkaConsumerProperties are set
+// on its fields, all others are set as extra properties. Secrets are never
+// copied into the spec: passwords of the SSL stores become PasswordProviders
+// and all other secrets are read through the DynamicConfigProvider, both from
+// the environment variables returned by ClientPropertyVariable.
+func SetClientProperties(props map[string]string, variablePrefix string) KafkaIngestionSpecOptions {
+	return func(spec *KafkaIngestionSpec) {
+		p := &spec.IOConfig.ConsumerProperties
+		fields := consumerPropertyFields(p)
+
+		keys := make([]string, 0, len(props))
+		for k := range props {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			value, secret := props[k], IsSecretClientProperty(k)
+			variable := ClientPropertyVariable(variablePrefix, k)
+			switch f := fields[k]; {
+			case f.IsValid() && f.Type() == reflect.TypeOf(&PasswordProvider{}):
+				f.Set(reflect.ValueOf(environmentPassword(variable)))
+			case secret:
+				p.setDynamicConfig(k, variable)
+			case f.IsValid() && f.Kind() == reflect.String:
+				f.SetString(value)
+			case f.IsValid() && f.Type() == reflect.TypeOf(stringPointer("")):
+				f.Set(reflect.ValueOf(stringPointer(value)))
+			default:
+				SetConsumerProperty(k, value)(spec)
+			}
+		}
+	}
+}
+
+// consumerPropertyFields returns the settable fields of p by their property
+// key.
+func consumerPropertyFields(p *KafkaConsumerProperties) map[string]reflect.Value {
+	fields := make(map[string]reflect.Value)
+	v := reflect.ValueOf(p).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			fields[name] = v.Field(i)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2020 noris network AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingestion
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const clientProperties = `# Kafka client config
+bootstrap.servers=kafka01:9093,kafka02:9093
+security.protocol = SASL_SSL
+sasl.mechanism: SCRAM-SHA-512
+sasl.jaas.config=org.apache.kafka.common.security.scram.ScramLoginModule required \
+    username="druid" \
+    password="secret";
+! another comment
+ssl.truststore.location /etc/kafka/truststore.jks
+ssl.truststore.password=changeit
+client.rack=dc1
+`
+
+func TestParseJavaProperties(t *testing.T) {
+	props, err := ParseJavaProperties(strings.NewReader(clientProperties))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"bootstrap.servers":       "kafka01:9093,kafka02:9093",
+		"security.protocol":       "SASL_SSL",
+		"sasl.mechanism":          "SCRAM-SHA-512",
+		"sasl.jaas.config":        `org.apache.kafka.common.security.scram.ScramLoginModule required username="druid" password="secret";`,
+		"ssl.truststore.location": "/etc/kafka/truststore.jks",
+		"ssl.truststore.password": "changeit",
+		"client.rack":             "dc1",
+	}, props)
+
+	_, err = ParseJavaProperties(strings.NewReader(`key=\u00zz`))
+	assert.Error(t, err)
+}
+
+func TestSetClientProperties(t *testing.T) {
+	props, err := ParseJavaProperties(strings.NewReader(clientProperties))
+	assert.NoError(t, err)
+	spec := NewKafkaIngestionSpec(SetClientProperties(props, "DRUID_KAFKA_"))
+
+	assert.Equal(t, KafkaConsumerProperties{
+		BootstrapServers:      "kafka01:9093,kafka02:9093",
+		SecurityProtocol:      stringPointer("SASL_SSL"),
+		SASLMechanism:         stringPointer("SCRAM-SHA-512"),
+		SSLTruststoreLocation: stringPointer("/etc/kafka/truststore.jks"),
+		SSLTruststorePassword: &PasswordProvider{
+			Type:     "environment",
+			Variable: "DRUID_KAFKA_SSL_TRUSTSTORE_PASSWORD",
+		},
+		DynamicConfigProvider: &DynamicConfigProvider{
+			Type:      "environment",
+			Variables: map[string]string{"sasl.jaas.config": "DRUID_KAFKA_SASL_JAAS_CONFIG"},
+		},
+		Extra: map[string]interface{}{"client.rack": "dc1"},
+	}, spec.IOConfig.ConsumerProperties)
+
+	actual, err := json.Marshal(spec)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(actual), "secret")
+	assert.NotContains(t, string(actual), "changeit")
+}
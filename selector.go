@@ -0,0 +1,116 @@
+/*
+Copyright 2020 noris network AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingestion
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// ParseSelectors returns the label matchers of every vector selector in a
+// PromQL query, e.g. '{__name__=~"job:.+"}' or 'sum(rate(foo{job="a"}[5m]))'.
+func ParseSelectors(query string) ([][]*labels.Matcher, error) {
+	expr, err := parser.ParseExpr(query)
+	if err != nil {
+		return nil, fmt.Errorf("parsing query: %w", err)
+	}
+	var selectors [][]*labels.Matcher
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		if vs, ok := node.(*parser.VectorSelector); ok {
+			selectors = append(selectors, vs.LabelMatchers)
+		}
+		return nil
+	})
+	if len(selectors) == 0 {
+		return nil, errors.New("query doesn't select any series")
+	}
+	return selectors, nil
+}
+
+// matcherFilter translates a label matcher into a filter on the column of the
+// label. Like in Prometheus a missing label is treated as an empty value, and
+// regular expressions have to match the whole value.
+func matcherFilter(m *labels.Matcher, column string) Filter {
+	missing := Filter{Type: "selector", Dimension: column}
+	if m.Value == "" && (m.Type == labels.MatchEqual || m.Type == labels.MatchNotEqual) {
+		if m.Type == labels.MatchEqual {
+			return missing
+		}
+		return Filter{Type: "not", Field: &missing}
+	}
+
+	var f Filter
+	switch m.Type {
+	case labels.MatchEqual, labels.MatchNotEqual:
+		f = Filter{Type: "selector", Dimension: column, Value: m.Value}
+	case labels.MatchRegexp, labels.MatchNotRegexp:
+		f = Filter{Type: "regex", Dimension: column, Pattern: "^(?:" + m.Value + ")$"}
+	}
+	negated := m.Type == labels.MatchNotEqual || m.Type == labels.MatchNotRegexp
+	if negated {
+		inner := f
+		f = Filter{Type: "not", Field: &inner}
+	}
+
+	switch {
+	case m.Matches(""):
+		return Filter{Type: "or", Fields: []Filter{f, missing}}
+	case negated:
+		return Filter{Type: "and", Fields: []Filter{f, {Type: "not", Field: &missing}}}
+	}
+	return f
+}
+
+// FilterSeries only ingests the series selected by any of the selectors, as
+// returned by ParseSelectors. The filter is combined with an existing filter
+// of the transformSpec. Labels that aren't dimensions are extracted by the
+// flattenSpec without being stored. It has to be applied after SetLabels and
+// RenameCollidingLabels.
+func FilterSeries(selectors ...[]*labels.Matcher) KafkaIngestionSpecOptions {
+	return func(spec *KafkaIngestionSpec) {
+		if len(selectors) == 0 {
+			return
+		}
+		alternatives := make([]Filter, 0, len(selectors))
+		for _, matchers := range selectors {
+			conditions := make([]Filter, 0, len(matchers))
+			for _, m := range matchers {
+				conditions = append(conditions, matcherFilter(m, spec.labelColumn(m.Name)))
+			}
+			alternatives = append(alternatives, combineFilters("and", conditions))
+		}
+		f := combineFilters("or", alternatives)
+
+		ts := spec.transformSpec()
+		if ts.Filter != nil {
+			f = Filter{Type: "and", Fields: []Filter{*ts.Filter, f}}
+		}
+		ts.Filter = &f
+	}
+}
+
+// combineFilters combines filters with 'and' or 'or', unless there is only
+// one.
+func combineFilters(typ string, filters []Filter) Filter {
+	if len(filters) == 1 {
+		return filters[0]
+	}
+	return Filter{Type: typ, Fields: filters}
+}
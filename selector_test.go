@@ -0,0 +1,153 @@
+/*
+Copyright 2020 noris network AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingestion
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSelectors(t *testing.T) {
+	selectors, err := ParseSelectors(`sum(rate(http_requests_total{job="api"}[5m])) / on(job) up`)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]*labels.Matcher{
+		{
+			labels.MustNewMatcher(labels.MatchEqual, "job", "api"),
+			labels.MustNewMatcher(labels.MatchEqual, "__name__", "http_requests_total"),
+		},
+		{
+			labels.MustNewMatcher(labels.MatchEqual, "__name__", "up"),
+		},
+	}, selectors)
+
+	_, err = ParseSelectors(`vector(1)`)
+	assert.Error(t, err)
+	_, err = ParseSelectors(`{__name__=~"job:.+"`)
+	assert.Error(t, err)
+}
+
+func TestMatcherFilter(t *testing.T) {
+	missing := Filter{Type: "selector", Dimension: "job"}
+	var testData = []struct {
+		matcher  *labels.Matcher
+		expected Filter
+	}{
+		{
+			matcher:  labels.MustNewMatcher(labels.MatchEqual, "job", "api"),
+			expected: Filter{Type: "selector", Dimension: "job", Value: "api"},
+		},
+		{
+			matcher:  labels.MustNewMatcher(labels.MatchEqual, "job", ""),
+			expected: missing,
+		},
+		{
+			matcher:  labels.MustNewMatcher(labels.MatchNotEqual, "job", ""),
+			expected: Filter{Type: "not", Field: &missing},
+		},
+		{
+			matcher: labels.MustNewMatcher(labels.MatchNotEqual, "job", "api"),
+			expected: Filter{Type: "or", Fields: []Filter{
+				{Type: "not", Field: &Filter{Type: "selector", Dimension: "job", Value: "api"}},
+				missing,
+			}},
+		},
+		{
+			matcher:  labels.MustNewMatcher(labels.MatchRegexp, "job", "api|web"),
+			expected: Filter{Type: "regex", Dimension: "job", Pattern: "^(?:api|web)$"},
+		},
+		{
+			matcher: labels.MustNewMatcher(labels.MatchRegexp, "job", "api|"),
+			expected: Filter{Type: "or", Fields: []Filter{
+				{Type: "regex", Dimension: "job", Pattern: "^(?:api|)$"},
+				missing,
+			}},
+		},
+		{
+			matcher: labels.MustNewMatcher(labels.MatchNotRegexp, "job", "api|web"),
+			expected: Filter{Type: "or", Fields: []Filter{
+				{Type: "not", Field: &Filter{Type: "regex", Dimension: "job", Pattern: "^(?:api|web)$"}},
+				missing,
+			}},
+		},
+		{
+			matcher: labels.MustNewMatcher(labels.MatchNotRegexp, "job", ".*"),
+			expected: Filter{Type: "and", Fields: []Filter{
+				{Type: "not", Field: &Filter{Type: "regex", Dimension: "job", Pattern: "^(?:.*)$"}},
+				{Type: "not", Field: &missing},
+			}},
+		},
+	}
+
+	for _, test := range testData {
+		t.Run(test.matcher.String(), func(t *testing.T) {
+			assert.Equal(t, test.expected, matcherFilter(test.matcher, "job"))
+		})
+	}
+}
+
+func TestFilterSeries(t *testing.T) {
+	selectors, err := ParseSelectors(`{__name__=~"job:.+", env="prod"}`)
+	assert.NoError(t, err)
+	spec := NewKafkaIngestionSpec(
+		SetLabels(LabelSet{"job"}),
+		SetTransformFilter(Filter{Type: "expression", Expression: "value == value"}),
+		FilterSeries(selectors...),
+	)
+	assert.NoError(t, spec.Validate())
+
+	// env is extracted for the filter, but not stored as a dimension
+	assert.Contains(t, spec.flattenSpec().Fields, Field{Type: "path", Name: "env", Expr: "$.labels.env"})
+	assert.NotContains(t, spec.dimensionsSpec().Dimensions, "env")
+
+	actual, err := json.MarshalIndent(spec.DataSchema.TransformSpec.Filter, "", "    ")
+	assert.NoError(t, err)
+	assert.Equal(t, `{
+    "type": "and",
+    "fields": [
+        {
+            "type": "expression",
+            "expression": "value == value"
+        },
+        {
+            "type": "and",
+            "fields": [
+                {
+                    "type": "regex",
+                    "dimension": "name",
+                    "pattern": "^(?:job:.+)$"
+                },
+                {
+                    "type": "selector",
+                    "dimension": "env",
+                    "value": "prod"
+                }
+            ]
+        }
+    ]
+}`, string(actual))
+
+	selectors, err = ParseSelectors(`up or down`)
+	assert.NoError(t, err)
+	spec = NewKafkaIngestionSpec(FilterSeries(selectors...))
+	assert.Equal(t, &Filter{Type: "or", Fields: []Filter{
+		{Type: "selector", Dimension: "name", Value: "up"},
+		{Type: "selector", Dimension: "name", Value: "down"},
+	}}, spec.DataSchema.TransformSpec.Filter)
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2020 noris network AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingestion
+
+import (
+	"fmt"
+	"strings"
+)
+
+// quantilesSketchType is the aggregator of the quantiles sketch on 'value'.
+// Like the distinct count sketches it needs the druid-datasketches extension.
+const quantilesSketchType = "quantilesDoublesSketch"
+
+// SketchType is the type of a distinct count sketch.
+type SketchType string
+
+// Distinct count sketches supported by the druid-datasketches extension.
+const (
+	SketchTypeHLL   SketchType = "HLLSketchBuild"
+	SketchTypeTheta SketchType = "thetaSketch"
+)
+
+// ParseSketchType parses the name of a distinct count sketch, either 'hll' or
+// 'theta'.
+func ParseSketchType(s string) (SketchType, error) {
+	switch strings.ToLower(s) {
+	case "hll":
+		return SketchTypeHLL, nil
+	case "theta":
+		return SketchTypeTheta, nil
+	}
+	return "", fmt.Errorf("unknown sketch type %q, expected 'hll' or 'theta'", s)
+}
+
+// suffix returns the suffix of the metric names of the sketch type.
+func (t SketchType) suffix() string {
+	if t == SketchTypeHLL {
+		return "_hll"
+	}
+	return "_theta"
+}
+
+func isPowerOfTwo(n int) bool {
+	return n > 0 && n&(n-1) == 0
+}
+
+// validateSketchSize checks the size parameters of sketch aggregators. Zero
+// means Druid's default.
+func validateSketchSize(m Metric) error {
+	switch m.Type {
+	case quantilesSketchType:
+		if m.K != 0 && (!isPowerOfTwo(m.K) || m.K < 2 || m.K > 32768) {
+			return fmt.Errorf("k must be a power of 2 from 2 to 32768, got %d", m.K)
+		}
+	case string(SketchTypeHLL):
+		if m.LgK != 0 && (m.LgK < 4 || m.LgK > 21) {
+			return fmt.Errorf("lgK must be from 4 to 21, got %d", m.LgK)
+		}
+	case string(SketchTypeTheta):
+		if m.Size != 0 && (!isPowerOfTwo(m.Size) || m.Size < 16) {
+			return fmt.Errorf("size must be a power of 2 of at least 16, got %d", m.Size)
+		}
+	}
+	return nil
+}
+
+// AddQuantilesSketch adds a quantilesDoublesSketch of 'value' called
+// 'value_sketch', so quantiles of the values can be computed on rolled up
+// data. k controls the size and accuracy of the sketch, 0 uses Druid's
+// default of 128.
+func AddQuantilesSketch(k int) KafkaIngestionSpecOptions {
+	return AddMetrics(Metric{Name: "value_sketch", Type: quantilesSketchType, FieldName: "value", K: k})
+}
+
+// AddDistinctCountSketches adds a distinct count sketch of each label, called
+// like the column of the label with the suffix '_hll' or '_theta', so the
+// distinct values of the label can be counted on rolled up data. Labels that
+// aren't dimensions are extracted by the flattenSpec without being stored.
+// size is the lgK of HLL sketches and the size of theta sketches, 0 uses
+// Druid's default. It has to be applied after SetLabels and
+// RenameCollidingLabels.
+func AddDistinctCountSketches(t SketchType, size int, labels ...string) KafkaIngestionSpecOptions {
+	return func(spec *KafkaIngestionSpec) {
+		for _, label := range labels {
+			column := spec.labelColumn(label)
+			m := Metric{Name: column + t.suffix(), Type: string(t), FieldName: column}
+			if t == SketchTypeHLL {
+				m.LgK = size
+			} else {
+				m.Size = size
+			}
+			spec.DataSchema.MetricsSpec = append(spec.DataSchema.MetricsSpec, m)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2020 noris network AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingestion
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSketchType(t *testing.T) {
+	typ, err := ParseSketchType("HLL")
+	assert.NoError(t, err)
+	assert.Equal(t, SketchTypeHLL, typ)
+
+	typ, err = ParseSketchType("theta")
+	assert.NoError(t, err)
+	assert.Equal(t, SketchTypeTheta, typ)
+
+	_, err = ParseSketchType("cpc")
+	assert.Error(t, err)
+}
+
+func TestAddSketches(t *testing.T) {
+	spec := NewKafkaIngestionSpec(
+		SetLabels(LabelSet{"job", "name"}),
+		RenameCollidingLabels("label_"),
+		AddQuantilesSketch(256),
+		AddDistinctCountSketches(SketchTypeHLL, 14, "name", "instance"),
+		AddDistinctCountSketches(SketchTypeTheta, 0, "job"),
+	)
+	assert.NoError(t, spec.Validate())
+	assert.Equal(t, []Metric{
+		{Name: "value_sketch", Type: "quantilesDoublesSketch", FieldName: "value", K: 256},
+		{Name: "label_name_hll", Type: "HLLSketchBuild", FieldName: "label_name", LgK: 14},
+		{Name: "instance_hll", Type: "HLLSketchBuild", FieldName: "instance", LgK: 14},
+		{Name: "job_theta", Type: "thetaSketch", FieldName: "job"},
+	}, spec.DataSchema.MetricsSpec[2:])
+
+	// instance is extracted for the sketch, but not stored as a dimension
+	assert.Contains(t, spec.flattenSpec().Fields, Field{Type: "path", Name: "instance", Expr: "$.labels.instance"})
+	assert.NotContains(t, spec.dimensionsSpec().Dimensions, "instance")
+}
+
+func TestValidateSketchSize(t *testing.T) {
+	var testData = []struct {
+		metric Metric
+		err    bool
+	}{
+		{metric: Metric{Type: quantilesSketchType}},
+		{metric: Metric{Type: quantilesSketchType, K: 32768}},
+		{metric: Metric{Type: quantilesSketchType, K: 100}, err: true},
+		{metric: Metric{Type: quantilesSketchType, K: 1}, err: true},
+		{metric: Metric{Type: "HLLSketchBuild", LgK: 21}},
+		{metric: Metric{Type: "HLLSketchBuild", LgK: 3}, err: true},
+		{metric: Metric{Type: "thetaSketch", Size: 16}},
+		{metric: Metric{Type: "thetaSketch", Size: 8}, err: true},
+		{metric: Metric{Type: "thetaSketch", Size: 1000}, err: true},
+	}
+
+	assert.Error(t, NewKafkaIngestionSpec(AddQuantilesSketch(100)).Validate())
+
+	for _, test := range testData {
+		err := validateSketchSize(test.metric)
+		if test.err {
+			assert.Error(t, err, "%+v", test.metric)
+			continue
+		}
+		assert.NoError(t, err, "%+v", test.metric)
+	}
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2020 noris network AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingestion
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ParseTransform parses an expression transform given as 'name=expression',
+// e.g. "namespace=regexp_extract(pod, '^([^-]+)', 1)".
+func ParseTransform(s string) (Transform, error) {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+		return Transform{}, fmt.Errorf("invalid transform %q, expected name=expression", s)
+	}
+	return Transform{
+		Type:       "expression",
+		Name:       strings.TrimSpace(parts[0]),
+		Expression: strings.TrimSpace(parts[1]),
+	}, nil
+}
+
+// transformSpec returns the TransformSpec of the spec, adding an empty one if
+// it has none.
+func (spec *KafkaIngestionSpec) transformSpec() *TransformSpec {
+	if spec.DataSchema.TransformSpec == nil {
+		spec.DataSchema.TransformSpec = &TransformSpec{}
+	}
+	return spec.DataSchema.TransformSpec
+}
+
+// AddTransforms adds transforms to the spec. Transforms can read the flatten
+// fields and shadow them, e.g. to normalize the values of a label.
+func AddTransforms(transforms ...Transform) KafkaIngestionSpecOptions {
+	return func(spec *KafkaIngestionSpec) {
+		ts := spec.transformSpec()
+		ts.Transforms = append(ts.Transforms, transforms...)
+	}
+}
+
+// AddTransformDimensions adds transforms to the spec and stores their results
+// as dimensions, e.g. the namespace extracted from the 'pod' label. It has to
+// be applied after SetLabels. Without dimensions Druid discovers them, which
+// includes the results of the transforms.
+func AddTransformDimensions(transforms ...Transform) KafkaIngestionSpecOptions {
+	return func(spec *KafkaIngestionSpec) {
+		AddTransforms(transforms...)(spec)
+		ds := spec.dimensionsSpec()
+		if len(ds.Dimensions) == 0 {
+			return
+		}
+		names := make(LabelSet, 0, len(transforms))
+		for _, t := range transforms {
+			names = append(names, t.Name)
+		}
+		ds.Dimensions = ds.Dimensions.Union(names)
+	}
+}
+
+// SetTransformFilter sets the filter rows have to match to be ingested.
+func SetTransformFilter(f Filter) KafkaIngestionSpecOptions {
+	return func(spec *KafkaIngestionSpec) {
+		spec.transformSpec().Filter = &f
+	}
+}
+
+// Validate checks that the transforms are expressions with unique names.
+func (ts TransformSpec) Validate() error {
+	names := make(map[string]bool, len(ts.Transforms))
+	for _, t := range ts.Transforms {
+		switch {
+		case t.Name == "":
+			return errors.New("transform without name")
+		case t.Type != "expression":
+			return fmt.Errorf("transform %q: unknown type %q", t.Name, t.Type)
+		case t.Expression == "":
+			return fmt.Errorf("transform %q: empty expression", t.Name)
+		case names[t.Name]:
+			return fmt.Errorf("transform %q: defined more than once", t.Name)
+		}
+		names[t.Name] = true
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2020 noris network AG
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingestion
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTransform(t *testing.T) {
+	actual, err := ParseTransform("namespace = regexp_extract(pod, '^([^-]+)', 1)")
+	assert.NoError(t, err)
+	assert.Equal(t, Transform{Type: "expression", Name: "namespace", Expression: "regexp_extract(pod, '^([^-]+)', 1)"}, actual)
+
+	actual, err = ParseTransform("up=value == 1")
+	assert.NoError(t, err)
+	assert.Equal(t, "value == 1", actual.Expression)
+
+	for _, in := range []string{"namespace", "=pod", "namespace="} {
+		_, err := ParseTransform(in)
+		assert.Error(t, err, in)
+	}
+}
+
+func TestAddTransformDimensions(t *testing.T) {
+	spec := NewKafkaIngestionSpec(
+		SetLabels(LabelSet{"pod", "instance"}),
+		AddTransformDimensions(
+			Transform{Type: "expression", Name: "namespace", Expression: "regexp_extract(pod, '^([^-]+)', 1)"},
+			Transform{Type: "expression", Name: "instance", Expression: "lower(instance)"},
+		),
+		SetTransformFilter(Filter{Type: "expression", Expression: "notnull(pod)"}),
+	)
+	assert.NoError(t, spec.Validate())
+	assert.Equal(t, LabelSet{"name", "pod", "instance", "namespace"}, spec.dimensionsSpec().Dimensions)
+
+	actual, err := json.MarshalIndent(spec.DataSchema.TransformSpec, "", "    ")
+	assert.NoError(t, err)
+	assert.Equal(t, `{
+    "transforms": [
+        {
+            "type": "expression",
+            "name": "namespace",
+            "expression": "regexp_extract(pod, '^([^-]+)', 1)"
+        },
+        {
+            "type": "expression",
+            "name": "instance",
+            "expression": "lower(instance)"
+        }
+    ],
+    "filter": {
+        "type": "expression",
+        "expression": "notnull(pod)"
+    }
+}`, string(actual))
+
+	// Without dimensions Druid discovers them, including the transforms.
+	spec = NewKafkaIngestionSpec(AddTransformDimensions(Transform{Type: "expression", Name: "namespace", Expression: "pod"}))
+	assert.Empty(t, spec.dimensionsSpec().Dimensions)
+}
+
+func TestTransformSpec_Validate(t *testing.T) {
+	valid := Transform{Type: "expression", Name: "namespace", Expression: "pod"}
+	var testData = []struct {
+		name       string
+		transforms []Transform
+		err        bool
+	}{
+		{name: "valid", transforms: []Transform{valid}},
+		{name: "without name", transforms: []Transform{{Type: "expression", Expression: "pod"}}, err: true},
+		{name: "unknown type", transforms: []Transform{{Type: "javascript", Name: "namespace", Expression: "pod"}}, err: true},
+		{name: "empty expression", transforms: []Transform{{Type: "expression", Name: "namespace"}}, err: true},
+		{name: "duplicate", transforms: []Transform{valid, valid}, err: true},
+	}
+
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			err := NewKafkaIngestionSpec(AddTransforms(test.transforms...)).Validate()
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}